@@ -8,11 +8,23 @@ THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR I
 package main
 
 import (
+	"crypto/tls"
 	"errors"
+	"github.com/SadPencil/sdunetd/sdunet"
 	"github.com/SadPencil/sdunetd/setting"
+	"github.com/SadPencil/sdunetd/utils"
+	"net"
 	"strings"
 )
 
+var tlsVersions = map[string]uint16{
+	"":                      0,
+	setting.TLS_VERSION_1_0: tls.VersionTLS10,
+	setting.TLS_VERSION_1_1: tls.VersionTLS11,
+	setting.TLS_VERSION_1_2: tls.VersionTLS12,
+	setting.TLS_VERSION_1_3: tls.VersionTLS13,
+}
+
 func checkAuthServer(settings *setting.Settings) (err error) {
 	settings.Account.AuthServer = strings.TrimSpace(settings.Account.AuthServer)
 
@@ -22,12 +34,12 @@ func checkAuthServer(settings *setting.Settings) (err error) {
 
 	if len(settings.Account.AuthServer) >= 5 {
 		if settings.Account.AuthServer[0:5] == "http:" {
-			return errors.New(`I'm asking you about the server's FQDN, not the URI. Please remove "http://".`)
+			return errors.New(msg("check.server_uri", "http://"))
 		}
 	}
 	if len(settings.Account.AuthServer) >= 6 {
 		if settings.Account.AuthServer[0:6] == "https:" {
-			return errors.New(`I'm asking you about the server's FQDN, not the URI. Please remove "https:".`)
+			return errors.New(msg("check.server_uri", "https://"))
 		}
 	}
 
@@ -37,16 +49,25 @@ func checkUsername(settings *setting.Settings) (err error) {
 	settings.Account.Username = strings.TrimSpace(settings.Account.Username)
 
 	if settings.Account.Username == "" {
-		return errors.New("Dude. I can't login without a username.")
+		return errors.New(msg("check.username_empty"))
 	}
 
 	return nil
 }
 func checkPassword(settings *setting.Settings) (err error) {
 	settings.Account.Password = strings.TrimSpace(settings.Account.Password)
+	settings.Account.PasswordFile = strings.TrimSpace(settings.Account.PasswordFile)
+	settings.Account.PasswordCommand = strings.TrimSpace(settings.Account.PasswordCommand)
+	settings.Account.PasswordCredential = strings.TrimSpace(settings.Account.PasswordCredential)
+	settings.Account.EncryptedPassword = strings.TrimSpace(settings.Account.EncryptedPassword)
+	settings.Account.KeyFile = strings.TrimSpace(settings.Account.KeyFile)
 
-	if settings.Account.Password == "" {
-		return errors.New("Give me your password, bitch. 'Cause I need it to hack into your... Ah, I mean, login the network.")
+	sources := passwordSources(settings.Account)
+	if len(sources) == 0 {
+		return errors.New(msg("check.password_empty"))
+	}
+	if len(sources) > 1 {
+		return errors.New(msg("check.password_sources", strings.Join(sources, ", ")))
 	}
 
 	return nil
@@ -56,16 +77,119 @@ func checkScheme(settings *setting.Settings) (err error) {
 
 	if settings.Account.Scheme == "" {
 		settings.Account.Scheme = setting.DEFAULT_AUTH_SCHEME
-	} else if strings.Contains(settings.Account.Scheme, "fuck") {
-		return errors.New("Fuck you! You are a fucking asshole.")
 	} else if !(settings.Account.Scheme == "http" || settings.Account.Scheme == "https") {
-		return errors.New("HTTP or HTTPS. Douchebag.")
+		return errors.New(msg("check.scheme_invalid"))
 	}
 	return nil
 }
 func checkInterval(settings *setting.Settings) error {
-	if settings.Control.LoopIntervalSec == 0 {
-		return errors.New("interval should be more than 0 seconds")
+	if settings.Control.LoopIntervalSec <= 0 {
+		return errors.New(msg("check.interval"))
+	}
+	return nil
+}
+func checkIPSource(settings *setting.Settings) error {
+	settings.Network.IPSource = strings.ToLower(strings.TrimSpace(settings.Network.IPSource))
+	settings.Network.IP = strings.TrimSpace(settings.Network.IP)
+	settings.Network.IPCommand = strings.TrimSpace(settings.Network.IPCommand)
+
+	switch settings.Network.IPSource {
+	case "":
+		settings.Network.IPSource = setting.IP_SOURCE_PORTAL
+	case setting.IP_SOURCE_PORTAL:
+	case setting.IP_SOURCE_INTERFACE:
+		if settings.Network.Interface == "" {
+			return errors.New(msg("check.ip_source_interface"))
+		}
+	case setting.IP_SOURCE_FIXED:
+		if net.ParseIP(settings.Network.IP) == nil {
+			return errors.New(msg("check.ip_source_fixed"))
+		}
+	case setting.IP_SOURCE_COMMAND:
+		if settings.Network.IPCommand == "" {
+			return errors.New(msg("check.ip_source_command"))
+		}
+	default:
+		return errors.New(msg("check.ip_source_invalid"))
+	}
+	return nil
+}
+func checkDevices(settings *setting.Settings) error {
+	seen := make(map[string]bool)
+	for i := range settings.Devices {
+		device := &settings.Devices[i]
+		device.Name = strings.TrimSpace(device.Name)
+		device.IP = strings.TrimSpace(device.IP)
+		device.Username = strings.TrimSpace(device.Username)
+		device.Password = strings.TrimSpace(device.Password)
+		device.PasswordFile = strings.TrimSpace(device.PasswordFile)
+		device.PasswordCommand = strings.TrimSpace(device.PasswordCommand)
+		device.PasswordCredential = strings.TrimSpace(device.PasswordCredential)
+		device.EncryptedPassword = strings.TrimSpace(device.EncryptedPassword)
+		device.KeyFile = strings.TrimSpace(device.KeyFile)
+
+		if net.ParseIP(device.IP) == nil {
+			return errors.New(msg("check.device_ip", i))
+		}
+		if device.ReloginIntervalSec < 0 {
+			return errors.New(msg("check.device_relogin_interval", i))
+		}
+		if sources := passwordSources(deviceAccount(*device)); len(sources) > 1 {
+			return errors.New(msg("check.device_password_sources", i, strings.Join(sources, ", ")))
+		}
+		if seen[device.IP] {
+			return errors.New(msg("check.device_duplicate", device.IP))
+		}
+		seen[device.IP] = true
+		if device.Name == "" {
+			device.Name = device.IP
+		}
+		if device.Username == "" {
+			device.Username = settings.Account.Username
+		}
+	}
+	return nil
+}
+func checkBindMode(settings *setting.Settings) error {
+	settings.Network.BindMode = strings.ToLower(strings.TrimSpace(settings.Network.BindMode))
+	settings.Network.BindAddress = strings.TrimSpace(settings.Network.BindAddress)
+
+	switch settings.Network.BindMode {
+	case "":
+		settings.Network.BindMode = setting.BIND_MODE_DEVICE
+	case setting.BIND_MODE_DEVICE, setting.BIND_MODE_ADDRESS:
+	default:
+		return errors.New(msg("check.bind_mode"))
+	}
+	if settings.Network.BindAddress != "" && net.ParseIP(settings.Network.BindAddress) == nil {
+		return errors.New(msg("check.bind_address"))
+	}
+	if settings.Network.TOS < 0 || settings.Network.TOS > 255 {
+		return errors.New(msg("check.tos"))
+	}
+	return nil
+}
+func checkTLS(settings *setting.Settings) error {
+	settings.Network.TLS.CAFile = strings.TrimSpace(settings.Network.TLS.CAFile)
+	settings.Network.TLS.ServerName = strings.TrimSpace(settings.Network.TLS.ServerName)
+	settings.Network.TLS.MinVersion = strings.TrimSpace(settings.Network.TLS.MinVersion)
+
+	if _, ok := tlsVersions[settings.Network.TLS.MinVersion]; !ok {
+		return errors.New(msg("check.tls_version"))
+	}
+	for _, pin := range settings.Network.TLS.PinSHA256 {
+		if _, err := sdunet.ParsePinSHA256(pin); err != nil {
+			return err
+		}
+	}
+	if settings.Network.TLS.CAFile != "" {
+		exist, err := utils.PathExists(settings.Network.TLS.CAFile)
+		if err != nil {
+			return err
+		}
+		if !exist {
+			return errors.New(msg("check.ca_file", settings.Network.TLS.CAFile))
+		}
 	}
 	return nil
 }
@@ -0,0 +1,50 @@
+/*
+Copyright © 2018-2022 Sad Pencil
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the “Software”), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+type command struct {
+	Name        string
+	Description string
+	Run         func(args []string) error
+}
+
+var commands = []command{
+	{Name: "config", Description: "inspect the configuration. Run \"sdunetd config\" to list the config commands.", Run: config},
+	{Name: "simulate", Description: "run the daemon against a fake portal on localhost, driven by a scenario file.", Run: simulate},
+}
+
+func printCommands() {
+	fmt.Fprintln(flag.CommandLine.Output(), "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintln(flag.CommandLine.Output(), "  "+cmd.Name)
+		fmt.Fprintln(flag.CommandLine.Output(), "    \t"+cmd.Description)
+	}
+	fmt.Fprintln(flag.CommandLine.Output(), `Run "sdunetd <command> -h" to show the help of a command.`)
+}
+
+func runCommand(name string, args []string) {
+	for _, cmd := range commands {
+		if cmd.Name == name {
+			err := cmd.Run(args)
+			if err != nil {
+				logger.Println(err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	fmt.Fprintln(os.Stderr, "Unknown command:", name)
+	printCommands()
+	os.Exit(2)
+}
@@ -0,0 +1,677 @@
+/*
+Copyright © 2018-2022 Sad Pencil
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the “Software”), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/SadPencil/sdunetd/setting"
+	"github.com/SadPencil/sdunetd/utils"
+	"golang.org/x/term"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// overrideFlag records the value of a setting given on the command line. The value is validated against a scratch copy of the settings.
+type overrideFlag struct {
+	path      string
+	isBool    bool
+	overrides map[string]string
+}
+
+func (f *overrideFlag) String() string {
+	return ""
+}
+
+func (f *overrideFlag) Set(value string) error {
+	err := setting.ApplyOverrides(setting.NewSettings(), map[string]string{f.path: value})
+	if err != nil {
+		return err
+	}
+	f.overrides[f.path] = value
+	return nil
+}
+
+func (f *overrideFlag) IsBoolFlag() bool {
+	return f.isBool
+}
+
+// registerOverrideFlags adds a flag for every setting, e.g. --account.username, plus the short aliases like --username.
+func registerOverrideFlags(flags *flag.FlagSet) map[string]string {
+	overrides := make(map[string]string)
+	for _, field := range setting.Fields(setting.NewSettings()) {
+		flags.Var(&overrideFlag{path: field.Path, isBool: field.Kind == reflect.Bool, overrides: overrides},
+			field.Path, "override: the setting "+field.Path+", also read from $"+field.EnvName()+".")
+	}
+	for alias, path := range setting.FlagAliases {
+		flags.Var(&overrideFlag{path: path, overrides: overrides}, alias, "override: alias of --"+path+".")
+	}
+	return overrides
+}
+
+// loadEffectiveSettings merges the default settings, the config file, the SDUNETD_* environment variables and the flags, in this order.
+// An empty configFile means no config file.
+func loadEffectiveSettings(configFile string, flagOverrides map[string]string) (*setting.Settings, error) {
+	settings := setting.NewSettings()
+	if configFile != "" {
+		var err error
+		var notes []string
+		settings, notes, err = setting.LoadAndMigrateSettings(configFile)
+		if err != nil {
+			return nil, err
+		}
+		if len(notes) > 0 {
+			logger.Println(msg("config.migrated_in_memory", configFile))
+			for _, note := range notes {
+				logger.Println("  " + note)
+			}
+			logger.Println(msg("config.migrate_hint", configFile))
+		}
+		checkConfigPermission(configFile, settings)
+	}
+	err := applyOverrides(settings, flagOverrides)
+	if err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// applyOverrides applies the SDUNETD_* environment variables, and then the flags.
+func applyOverrides(settings *setting.Settings, flagOverrides map[string]string) error {
+	err := setting.ApplyOverrides(settings, setting.EnvOverrides(os.Environ()))
+	if err != nil {
+		return errors.New(msg("config.env_error", err))
+	}
+	err = setting.ApplyOverrides(settings, flagOverrides)
+	if err != nil {
+		return errors.New(msg("config.flag_error", err))
+	}
+	return nil
+}
+
+var configCommands = []command{
+	{Name: "check", Description: "report all the problems of the settings, and the unknown keys of the config file.", Run: configCheck},
+	{Name: "edit", Description: "edit a config file interactively, with the current settings as the default answers.", Run: configEdit},
+	{Name: "init", Description: "generate a config file, interactively or from the flags and the environment variables.", Run: configInit},
+	{Name: "migrate", Description: "rewrite a config file of an older layout in the current layout.", Run: configMigrate},
+	{Name: "presets", Description: "list the presets of the campus networks, which a config file refers to by \"preset\".", Run: configPresets},
+	{Name: "schema", Description: "print the JSON Schema of the config file.", Run: configSchema},
+	{Name: "show", Description: "print the settings with the secrets redacted.", Run: configShow},
+	{Name: "encrypt-password", Description: "encrypt the password of the config file with a key file or the machine-id.", Run: configEncryptPassword},
+	{Name: "rotate-key", Description: "re-encrypt the password of the config file with a new key file.", Run: configRotateKey},
+}
+
+func config(args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		printConfigCommands()
+		return errors.New(msg("config.command_required"))
+	}
+	for _, cmd := range configCommands {
+		if cmd.Name == args[0] {
+			return cmd.Run(args[1:])
+		}
+	}
+	printConfigCommands()
+	return errors.New(msg("config.command_unknown", args[0]))
+}
+
+func printConfigCommands() {
+	fmt.Fprintln(os.Stderr, msg("config.commands"))
+	for _, cmd := range configCommands {
+		fmt.Fprintln(os.Stderr, "  "+cmd.Name)
+		fmt.Fprintln(os.Stderr, "    \t"+cmd.Description)
+	}
+	fmt.Fprintln(os.Stderr, msg("config.command_help"))
+}
+
+func configCheck(args []string) error {
+	flags := flag.NewFlagSet("config check", flag.ExitOnError)
+
+	var FlagConfigFile string
+	flags.StringVar(&FlagConfigFile, "c", "", "the path to the config file. The SDUNETD_* environment variables and the override flags are applied on top of it.")
+
+	registerLanguageFlags(flags)
+
+	flagOverrides := registerOverrideFlags(flags)
+
+	_ = flags.Parse(args)
+
+	settings, err := loadEffectiveSettings(FlagConfigFile, flagOverrides)
+	if err != nil {
+		return err
+	}
+	problems := validateSettings(FlagConfigFile, settings)
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if FlagConfigFile != "" {
+		offerPermissionFix(FlagConfigFile)
+	}
+	if hasErrors(problems) {
+		return errors.New(msg("validate.invalid"))
+	}
+	if len(problems) == 0 {
+		fmt.Println(msg("validate.no_problem"))
+	}
+	return nil
+}
+
+func configEdit(args []string) error {
+	flags := flag.NewFlagSet("config edit", flag.ExitOnError)
+
+	var FlagConfigFile string
+	flags.StringVar(&FlagConfigFile, "c", setting.DEFAULT_CONFIG_FILENAME, "the path to the config file to edit. Comments in the file are lost if it is rewritten.")
+
+	registerLanguageFlags(flags)
+
+	_ = flags.Parse(args)
+
+	exist, err := utils.PathExists(FlagConfigFile)
+	if err != nil {
+		return err
+	}
+	if !exist {
+		return errors.New(msg("config.file_missing", FlagConfigFile))
+	}
+	err = cartman(FlagConfigFile, true)
+	if err != nil {
+		return err
+	}
+	// a rewritten file is already readable by the owner only
+	if settings, err := setting.LoadSettings(FlagConfigFile); err == nil {
+		checkConfigPermission(FlagConfigFile, settings)
+	}
+	offerPermissionFix(FlagConfigFile)
+	return nil
+}
+
+func configInit(args []string) error {
+	flags := flag.NewFlagSet("config init", flag.ExitOnError)
+
+	var FlagConfigFile string
+	flags.StringVar(&FlagConfigFile, "c", setting.DEFAULT_CONFIG_FILENAME, "the path to the config file to generate. The format is chosen by the extension.")
+
+	var FlagNonInteractive bool
+	flags.BoolVar(&FlagNonInteractive, "non-interactive", false, "take the settings from the SDUNETD_* environment variables and the override flags, instead of asking.")
+
+	var FlagForce bool
+	flags.BoolVar(&FlagForce, "force", false, "overwrite the config file if it exists.")
+
+	var FlagPreset string
+	flags.StringVar(&FlagPreset, "preset", "", `with --non-interactive: the preset of the network, applied before the environment variables and the flags. See "sdunetd config presets".`)
+
+	registerLanguageFlags(flags)
+
+	flagOverrides := registerOverrideFlags(flags)
+
+	_ = flags.Parse(args)
+
+	if !FlagNonInteractive {
+		if len(flagOverrides) > 0 {
+			return errors.New(msg("config.overrides_non_interactive"))
+		}
+	}
+
+	exist, err := utils.PathExists(FlagConfigFile)
+	if err != nil {
+		return err
+	}
+	if exist && !FlagForce {
+		return errors.New(msg("config.file_exists", FlagConfigFile))
+	}
+	if !FlagNonInteractive {
+		return cartman(FlagConfigFile, false)
+	}
+
+	settings := setting.NewSettings()
+	if FlagPreset != "" {
+		preset, err := setting.FindPreset(FlagPreset)
+		if err != nil {
+			return err
+		}
+		preset.Apply(settings)
+	}
+	err = applyOverrides(settings, flagOverrides)
+	if err != nil {
+		return err
+	}
+	problems := validateSettings("", settings)
+	for _, p := range problems {
+		logger.Println(p)
+	}
+	if hasErrors(problems) {
+		return errors.New(msg("validate.invalid"))
+	}
+
+	err = setting.SaveSettings(FlagConfigFile, settings)
+	if err != nil {
+		return err
+	}
+	logger.Println(msg("config.generated", FlagConfigFile))
+	return nil
+}
+
+func configMigrate(args []string) error {
+	flags := flag.NewFlagSet("config migrate", flag.ExitOnError)
+
+	var FlagConfigFile string
+	flags.StringVar(&FlagConfigFile, "c", "", "the path to the config file, which is rewritten. Comments in the file are lost.")
+
+	var FlagDryRun bool
+	flags.BoolVar(&FlagDryRun, "n", false, "print the migrated settings to stdout instead of rewriting the file.")
+
+	registerLanguageFlags(flags)
+
+	_ = flags.Parse(args)
+
+	if FlagConfigFile == "" {
+		return errors.New(msg("config.file_required"))
+	}
+	settings, notes, err := setting.LoadAndMigrateSettings(FlagConfigFile)
+	if err != nil {
+		return err
+	}
+	for _, note := range notes {
+		logger.Println(note)
+	}
+
+	if FlagDryRun {
+		format := setting.FormatFromExtension(FlagConfigFile)
+		if format == "" {
+			format = setting.FORMAT_JSON
+		}
+		content, err := setting.Marshal(format, setting.Redacted(settings))
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(content)
+		return err
+	}
+	if len(notes) == 0 {
+		logger.Println(msg("config.already_current"))
+		return nil
+	}
+	err = setting.SaveSettings(FlagConfigFile, settings)
+	if err != nil {
+		return err
+	}
+	logger.Println(msg("config.migrated", FlagConfigFile, settings.Version))
+	return nil
+}
+
+func configPresets(args []string) error {
+	flags := flag.NewFlagSet("config presets", flag.ExitOnError)
+	registerLanguageFlags(flags)
+
+	_ = flags.Parse(args)
+
+	for _, preset := range setting.LoadPresets() {
+		fmt.Println(preset.Name)
+		fmt.Println("    \t" + preset.Description)
+		fmt.Println("    \t" + msg("config.preset_settings", orUnset(strings.Join(preset.Servers, ", ")), orUnset(preset.Scheme),
+			orUnset(preset.AcID), orUnset(preset.OnlineDetectionMethod)))
+		if preset.Notes != "" {
+			fmt.Println("    \t" + preset.Notes)
+		}
+	}
+	fmt.Println(msg("config.preset_dirs", strings.Join(setting.PresetDirs(), ", ")))
+	return nil
+}
+
+// orUnset marks a setting that the preset leaves to the default or the config file.
+func orUnset(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func configSchema(args []string) error {
+	flags := flag.NewFlagSet("config schema", flag.ExitOnError)
+	_ = flags.Parse(args)
+
+	content, err := setting.MarshalSchema()
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(content)
+	return err
+}
+
+func configShow(args []string) error {
+	flags := flag.NewFlagSet("config show", flag.ExitOnError)
+
+	var FlagConfigFile string
+	flags.StringVar(&FlagConfigFile, "c", "", "the path to the config file. Leave it blank to start from the default settings.")
+
+	var FlagEffective bool
+	flags.BoolVar(&FlagEffective, "effective", false, "apply the SDUNETD_* environment variables and the override flags on top of the config file.")
+
+	var FlagFormat string
+	flags.StringVar(&FlagFormat, "format", "", "the output format: json, yaml or toml. Defaults to the format of the config file.")
+
+	registerLanguageFlags(flags)
+
+	flagOverrides := registerOverrideFlags(flags)
+
+	_ = flags.Parse(args)
+
+	var settings *setting.Settings
+	var err error
+	if FlagEffective {
+		settings, err = loadEffectiveSettings(FlagConfigFile, flagOverrides)
+	} else {
+		if len(flagOverrides) > 0 {
+			return errors.New(msg("config.overrides_effective"))
+		}
+		settings = setting.NewSettings()
+		if FlagConfigFile != "" {
+			settings, err = setting.LoadSettings(FlagConfigFile)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	format := strings.ToLower(FlagFormat)
+	if format == "" {
+		format = setting.FormatFromExtension(FlagConfigFile)
+	}
+	if format == "" {
+		format = setting.FORMAT_JSON
+	}
+	content, err := setting.Marshal(format, setting.Redacted(settings))
+	if err != nil {
+		return err
+	}
+	if format == setting.FORMAT_JSON {
+		content = append(content, '\n')
+	}
+	_, err = os.Stdout.Write(content)
+	return err
+}
+
+// hasOverrides tells whether any setting is given by the environment variables or the flags.
+func hasOverrides(flagOverrides map[string]string) bool {
+	return len(flagOverrides) > 0 || len(setting.EnvOverrides(os.Environ())) > 0
+}
+
+func configEncryptPassword(args []string) error {
+	flags := flag.NewFlagSet("config encrypt-password", flag.ExitOnError)
+
+	var FlagConfigFile string
+	flags.StringVar(&FlagConfigFile, "c", "", "the path to the config file, which is rewritten. Comments in the file are lost.")
+
+	var FlagKeyFile string
+	flags.StringVar(&FlagKeyFile, "key-file", "", "the path to the key file, generated if it doesn't exist. Leave it blank to keep the key file of the config file, or to use the machine-id.")
+
+	var FlagDevice string
+	flags.StringVar(&FlagDevice, "device", "", "the name or the IP address of the device whose password is encrypted, instead of the password of the account.")
+
+	registerLanguageFlags(flags)
+
+	_ = flags.Parse(args)
+
+	if FlagConfigFile == "" {
+		return errors.New(msg("config.file_required"))
+	}
+	settings, err := setting.LoadSettings(FlagConfigFile)
+	if err != nil {
+		return err
+	}
+	account := &settings.Account
+	var device *setting.Device
+	if FlagDevice != "" {
+		device, err = findDevice(settings, FlagDevice)
+		if err != nil {
+			return err
+		}
+		deviceSources := deviceAccount(*device)
+		account = &deviceSources
+	}
+
+	password := strings.TrimSpace(account.Password)
+	if password == "" {
+		password, err = readPasswordFromStdin()
+		if err != nil {
+			return err
+		}
+	}
+	if password == "" {
+		return errors.New(msg("config.password_empty"))
+	}
+
+	if FlagKeyFile != "" {
+		account.KeyFile = FlagKeyFile
+		exist, err := utils.PathExists(FlagKeyFile)
+		if err != nil {
+			return err
+		}
+		if !exist {
+			err = setting.GenerateKeyFile(FlagKeyFile)
+			if err != nil {
+				return err
+			}
+			logger.Println(msg("config.key_generated", FlagKeyFile))
+		}
+	}
+	key, err := setting.LoadKey(account.KeyFile)
+	if err != nil {
+		return err
+	}
+	encrypted, err := setting.EncryptPassword(key, password)
+	if err != nil {
+		return err
+	}
+
+	for _, source := range passwordSources(*account) {
+		if source != "password" && source != "encrypted_password" {
+			logger.Println(msg("config.source_replaced", source))
+		}
+	}
+	account.Password = ""
+	account.PasswordFile = ""
+	account.PasswordCommand = ""
+	account.PasswordCredential = ""
+	account.EncryptedPassword = encrypted
+	if device != nil {
+		setDevicePasswordSources(device, *account)
+	}
+
+	err = setting.SaveSettings(FlagConfigFile, settings)
+	if err != nil {
+		return err
+	}
+	logger.Println(msg("config.password_encrypted", FlagConfigFile))
+	return nil
+}
+
+// findDevice returns the device of the name or the IP address.
+func findDevice(settings *setting.Settings, nameOrIP string) (*setting.Device, error) {
+	for i := range settings.Devices {
+		device := &settings.Devices[i]
+		if strings.TrimSpace(device.Name) == nameOrIP || strings.TrimSpace(device.IP) == nameOrIP {
+			return device, nil
+		}
+	}
+	return nil, errors.New(msg("config.device_missing", nameOrIP))
+}
+
+func configRotateKey(args []string) error {
+	flags := flag.NewFlagSet("config rotate-key", flag.ExitOnError)
+
+	var FlagConfigFile string
+	flags.StringVar(&FlagConfigFile, "c", "", "the path to the config file, which is rewritten. Comments in the file are lost.")
+
+	var FlagKeyFile string
+	flags.StringVar(&FlagKeyFile, "key-file", "", "the path to the new key file, which must not exist. Leave it blank to replace the key file of the config file in place.")
+
+	registerLanguageFlags(flags)
+
+	_ = flags.Parse(args)
+
+	if FlagConfigFile == "" {
+		return errors.New(msg("config.file_required"))
+	}
+	settings, err := setting.LoadSettings(FlagConfigFile)
+	if err != nil {
+		return err
+	}
+
+	// the key file of the account, or of the first device if the password of the account is not encrypted, is rotated,
+	// along with the encrypted passwords of the devices sharing it
+	var accounts []*setting.Account
+	if settings.Account.EncryptedPassword != "" {
+		accounts = append(accounts, &settings.Account)
+	}
+	deviceAccounts := make([]setting.Account, len(settings.Devices))
+	for i, device := range settings.Devices {
+		deviceAccounts[i] = deviceAccount(device)
+		if device.EncryptedPassword != "" {
+			accounts = append(accounts, &deviceAccounts[i])
+		}
+	}
+	if len(accounts) == 0 {
+		return errors.New(msg("config.no_encrypted_password"))
+	}
+	oldKeyFile := accounts[0].KeyFile
+	var rotated []*setting.Account
+	for _, account := range accounts {
+		if account.KeyFile == oldKeyFile {
+			rotated = append(rotated, account)
+		}
+	}
+	setKeyFile := func(keyFile string) {
+		for _, account := range rotated {
+			account.KeyFile = keyFile
+		}
+		for i := range settings.Devices {
+			setDevicePasswordSources(&settings.Devices[i], deviceAccounts[i])
+		}
+	}
+
+	oldKey, err := setting.LoadKey(oldKeyFile)
+	if err != nil {
+		return err
+	}
+	passwords := make([]string, len(rotated))
+	for i, account := range rotated {
+		passwords[i], err = setting.DecryptPassword(oldKey, account.EncryptedPassword)
+		if err != nil {
+			return err
+		}
+	}
+
+	// generate the new key aside, so that the old key stays valid until the config file is saved
+	inPlace := FlagKeyFile == "" || FlagKeyFile == oldKeyFile
+	newKeyFile := FlagKeyFile
+	if inPlace {
+		if oldKeyFile == "" {
+			return errors.New(msg("config.rotate_machine_id"))
+		}
+		newKeyFile = oldKeyFile + ".new"
+	}
+	err = setting.GenerateKeyFile(newKeyFile)
+	if err != nil {
+		return err
+	}
+	newKey, err := setting.LoadKey(newKeyFile)
+	if err != nil {
+		return err
+	}
+	for i, account := range rotated {
+		account.EncryptedPassword, err = setting.EncryptPassword(newKey, passwords[i])
+		if err != nil {
+			return err
+		}
+	}
+	// the config file points to the new key file before the old one is replaced, so that the key file of the config
+	// file decrypts its passwords whenever the rotation is interrupted
+	setKeyFile(newKeyFile)
+	err = setting.SaveSettings(FlagConfigFile, settings)
+	if err != nil {
+		_ = os.Remove(newKeyFile)
+		return err
+	}
+	if !inPlace {
+		logger.Println(msg("config.key_reencrypted", newKeyFile))
+		if oldKeyFile != "" {
+			logger.Println(msg("config.key_unused", oldKeyFile))
+		}
+		return nil
+	}
+
+	// copy instead of rename, as the config file refers to the new key file until it is rewritten
+	content, err := ioutil.ReadFile(newKeyFile)
+	if err == nil {
+		err = utils.WriteFileAtomic(oldKeyFile, content, 0600)
+	}
+	if err == nil {
+		setKeyFile(oldKeyFile)
+		err = setting.SaveSettings(FlagConfigFile, settings)
+	}
+	if err != nil {
+		return errors.New(msg("config.key_replace_failed", newKeyFile, oldKeyFile, err))
+	}
+	_ = os.Remove(newKeyFile)
+	logger.Println(msg("config.key_rotated", oldKeyFile))
+	return nil
+}
+
+// readPasswordFromStdin prompts for the password on a terminal, or reads the first line of stdin otherwise.
+func readPasswordFromStdin() (string, error) {
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Fprintln(os.Stderr, msg("config.password_prompt"))
+		password, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		return strings.TrimSpace(string(password)), err
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// checkConfigPermission warns if the config file exposes the password to others.
+func checkConfigPermission(configFile string, settings *setting.Settings) {
+	err := setting.CheckPermission(configFile, settings)
+	if err != nil {
+		logger.Println(msg("config.permission_warning", configFile, err))
+	}
+}
+
+// offerPermissionFix asks on a terminal whether to make the config file readable by the owner only, if it exposes the
+// password to others. Nothing is changed unless the answer is yes.
+func offerPermissionFix(configFile string) {
+	settings, err := setting.LoadSettings(configFile)
+	if err != nil || setting.CheckPermission(configFile, settings) != setting.ErrInsecurePermission {
+		return
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return
+	}
+
+	fmt.Fprintln(os.Stderr, msg("config.permission_fix"))
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	if answer != "y" && answer != "yes" && answer != "是" {
+		return
+	}
+	err = setting.FixPermission(configFile)
+	if err != nil {
+		logger.Println(msg("config.permission_failed", err))
+		return
+	}
+	logger.Println(msg("config.permission_fixed", configFile))
+}
@@ -0,0 +1,276 @@
+/*
+Copyright © 2018-2022 Sad Pencil
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the “Software”), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"github.com/SadPencil/sdunetd/setting"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// captureStdout returns what the action writes to os.Stdout.
+func captureStdout(t *testing.T, action func() error) []byte {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	var output bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(&output, r)
+		close(done)
+	}()
+	err = action()
+	os.Stdout = stdout
+	_ = w.Close()
+	<-done
+	if err != nil {
+		t.Fatal(err)
+	}
+	return output.Bytes()
+}
+
+func TestConfigMigrateDryRun(t *testing.T) {
+	oldLogger := logger
+	logger = log.New(ioutil.Discard, "", 0)
+	defer func() { logger = oldLogger }()
+	dir, err := ioutil.TempDir("", "sdunetd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, file := range []string{"v2.4.json"} {
+		original, err := ioutil.ReadFile(filepath.Join("setting", "testdata", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		configPath := filepath.Join(dir, file)
+		if err := ioutil.WriteFile(configPath, original, 0600); err != nil {
+			t.Fatal(err)
+		}
+		want, _, err := setting.LoadAndMigrateSettings(configPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		output := captureStdout(t, func() error {
+			return configMigrate([]string{"-c", configPath, "-n"})
+		})
+		if content, _ := ioutil.ReadFile(configPath); !bytes.Equal(content, original) {
+			t.Errorf("%s: the dry run rewrites the file", file)
+		}
+
+		// the output is a config file in the current layout, with the secrets redacted
+		migratedPath := filepath.Join(dir, "migrated-"+file)
+		if err := ioutil.WriteFile(migratedPath, output, 0600); err != nil {
+			t.Fatal(err)
+		}
+		got, notes, err := setting.LoadAndMigrateSettings(migratedPath)
+		if err != nil {
+			t.Fatalf("%s: %v\n%s", file, err, output)
+		}
+		if len(notes) != 0 {
+			t.Errorf("%s: the output isn't in the current layout: %v", file, notes)
+		}
+		if !reflect.DeepEqual(got, setting.Redacted(want)) {
+			t.Errorf("%s: got %+v, want %+v", file, got, setting.Redacted(want))
+		}
+	}
+}
+
+func TestConfigRotateKeyInPlace(t *testing.T) {
+	oldLogger := logger
+	logger = log.New(ioutil.Discard, "", 0)
+	defer func() { logger = oldLogger }()
+	dir, err := ioutil.TempDir("", "sdunetd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyFile := filepath.Join(dir, "key")
+	err = setting.GenerateKeyFile(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldKey, err := setting.LoadKey(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := setting.NewSettings()
+	settings.Account.Username = "201700000000"
+	settings.Account.KeyFile = keyFile
+	settings.Account.EncryptedPassword, err = setting.EncryptPassword(oldKey, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the device sharing the key file is re-encrypted, and the one of another key file is untouched
+	otherKeyFile := filepath.Join(dir, "other")
+	err = setting.GenerateKeyFile(otherKeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := setting.LoadKey(otherKeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings.Devices = []setting.Device{{IP: "10.0.0.50", KeyFile: keyFile}, {IP: "10.0.0.51", KeyFile: otherKeyFile}}
+	settings.Devices[0].EncryptedPassword, err = setting.EncryptPassword(oldKey, "printer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings.Devices[1].EncryptedPassword, err = setting.EncryptPassword(otherKey, "board")
+	if err != nil {
+		t.Fatal(err)
+	}
+	configFile := filepath.Join(dir, "config.json")
+	err = setting.SaveSettings(configFile, settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a key file left by an interrupted rotation may be in use, so it is never overwritten
+	err = ioutil.WriteFile(keyFile+".new", []byte("in use"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := configRotateKey([]string{"-c", configFile}); err == nil {
+		t.Error("the key file of an interrupted rotation is overwritten")
+	}
+	_ = os.Remove(keyFile + ".new")
+
+	err = configRotateKey([]string{"-c", configFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := setting.LoadSettings(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.Account.KeyFile != keyFile {
+		t.Errorf("the config file points to %s, want %s", rotated.Account.KeyFile, keyFile)
+	}
+	newKey, err := setting.LoadKey(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(newKey, oldKey) {
+		t.Error("the key is not changed")
+	}
+	password, err := setting.DecryptPassword(newKey, rotated.Account.EncryptedPassword)
+	if err != nil || password != "secret" {
+		t.Errorf("the password is decrypted as %q, %v", password, err)
+	}
+	if rotated.Devices[0].KeyFile != keyFile || rotated.Devices[1].KeyFile != otherKeyFile {
+		t.Errorf("the devices point to %s and %s", rotated.Devices[0].KeyFile, rotated.Devices[1].KeyFile)
+	}
+	password, err = setting.DecryptPassword(newKey, rotated.Devices[0].EncryptedPassword)
+	if err != nil || password != "printer" {
+		t.Errorf("the password of the device is decrypted as %q, %v", password, err)
+	}
+	password, err = setting.DecryptPassword(otherKey, rotated.Devices[1].EncryptedPassword)
+	if err != nil || password != "board" {
+		t.Errorf("the password of the device of another key is decrypted as %q, %v", password, err)
+	}
+	if _, err := os.Stat(keyFile + ".new"); !os.IsNotExist(err) {
+		t.Errorf("the new key file is left: %v", err)
+	}
+}
+
+func TestConfigEncryptDevicePassword(t *testing.T) {
+	oldLogger := logger
+	logger = log.New(ioutil.Discard, "", 0)
+	defer func() { logger = oldLogger }()
+	dir, err := ioutil.TempDir("", "sdunetd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	settings := setting.NewSettings()
+	settings.Account.Password = "secret"
+	settings.Devices = []setting.Device{{Name: "printer", IP: "10.0.0.50", Password: "printer", PasswordFile: "password"}}
+	configFile := filepath.Join(dir, "config.json")
+	err = setting.SaveSettings(configFile, settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := configEncryptPassword([]string{"-c", configFile, "-device", "board"}); err == nil {
+		t.Error("an unknown device is accepted")
+	}
+
+	keyFile := filepath.Join(dir, "key")
+	err = configEncryptPassword([]string{"-c", configFile, "-device", "printer", "-key-file", keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := setting.LoadSettings(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encrypted.Account.Password != "secret" || encrypted.Account.EncryptedPassword != "" {
+		t.Errorf("the account is changed: %+v", encrypted.Account)
+	}
+	device := encrypted.Devices[0]
+	if device.Password != "" || device.PasswordFile != "" || device.KeyFile != keyFile {
+		t.Errorf("the other password sources are kept: %+v", device)
+	}
+	password, err := resolvePassword(context.Background(), deviceAccount(device))
+	if err != nil || password != "printer" {
+		t.Errorf("the password of the device is decrypted as %q, %v", password, err)
+	}
+}
+
+func TestLoadingOnlyWarnsAboutThePermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the permission bits are not checked on Windows")
+	}
+	var output bytes.Buffer
+	oldLogger := logger
+	logger = log.New(&output, "", 0)
+	defer func() { logger = oldLogger }()
+	dir, err := ioutil.TempDir("", "sdunetd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	configPath := filepath.Join(dir, "config.json")
+	err = ioutil.WriteFile(configPath, []byte(`{"account": {"username": "user", "password": "secret"}}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// fixing the permissions is only offered by "config check" and "config edit"
+	if err := os.Chmod(configPath, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadEffectiveSettings(configPath, nil); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("the permissions are changed to %v", info.Mode())
+	}
+	if !bytes.Contains(output.Bytes(), []byte(configPath)) {
+		t.Errorf("no warning is logged: %q", output.String())
+	}
+}
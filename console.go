@@ -9,8 +9,10 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/SadPencil/sdunetd/sdunet"
 	"github.com/SadPencil/sdunetd/setting"
@@ -24,81 +26,98 @@ import (
 	"syscall"
 )
 
-func cartman() {
+// cartman asks the questions to generate a config file. When edit is true and configFile exists, or configFile is empty
+// and the default config file exists, its settings are shown as the default answers, and the file is rewritten only if
+// anything changes. It returns an error when stdin is not a terminal, e.g. when started by systemd without a config file.
+func cartman(configFile string, edit bool) error {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return errors.New(msg("wizard.no_terminal"))
+	}
+
 	settings := setting.NewSettings()
 	reader := bufio.NewReader(os.Stdin)
 
-	fmt.Println("To generate a config file, a few questions need to be answered. Leave it blank if you want the default answer in the bracket.")
+	editing := false
+	var original []byte
+	if edit {
+		if configFile == "" {
+			exist, err := utils.PathExists(setting.DEFAULT_CONFIG_FILENAME)
+			if err != nil {
+				panic(err)
+			}
+			if exist && askYesOrNo(reader, msg("wizard.edit_found", setting.DEFAULT_CONFIG_FILENAME), true) {
+				configFile = setting.DEFAULT_CONFIG_FILENAME
+			}
+		}
+		if configFile != "" {
+			exist, err := utils.PathExists(configFile)
+			if err != nil {
+				panic(err)
+			}
+			if exist {
+				var notes []string
+				settings, notes, err = setting.LoadAndMigrateSettings(configFile)
+				if err != nil {
+					return err
+				}
+				editing = true
+				// a migrated file is saved even if no answer changes
+				if len(notes) == 0 {
+					original, _ = json.Marshal(settings)
+				}
+			}
+		}
+	}
 
-	var err error
+	if editing {
+		fmt.Println(msg("wizard.intro_edit", configFile))
+	} else {
+		fmt.Println(msg("wizard.intro"))
+	}
 
 	for {
 		fmt.Println()
-		fmt.Println("Question 0. Are you ready? [Yes]")
+		fmt.Println(msg("wizard.q0"))
 		ans, err := reader.ReadString('\n')
 		if err != nil {
 			panic(err)
 		}
 		ans = strings.TrimSpace(ans)
 		if ans == "" {
-			fmt.Println("Cool. Let's get started.")
+			fmt.Println(msg("wizard.q0_ready"))
 			break
 		} else {
-			fmt.Println("Ah, god dammit. I told you that you can just LEAVE IT BLANK if you want the default answer. Now try again.")
+			fmt.Println(msg("wizard.q0_retry"))
 		}
 	}
 
-	for {
-		fmt.Println()
-		fmt.Println("Question 1. What's your username? []")
+	askUsername(reader, settings)
+	askPassword(reader, settings)
 
-		settings.Account.Username, err = reader.ReadString('\n')
-		if err != nil {
-			panic(err)
-		}
-		err = checkUsername(settings)
-		if err != nil {
-			fmt.Println(err)
-		} else {
-			break
-		}
-	}
-	for {
-		fmt.Println()
-		fmt.Println("Question 2. What's your password? []")
-		bytePassword, err := term.ReadPassword(int(syscall.Stdin))
-		fmt.Println() // it's necessary to add a new line after user's input
-		if err != nil {
-			panic(err)
-		} else {
-			settings.Account.Password = string(bytePassword)
-		}
-		err = checkPassword(settings)
-		if err != nil {
-			fmt.Println(err)
-		} else {
-			fmt.Println("Great. Your password contains", fmt.Sprint(len(settings.Account.Password)), "characters.")
-			break
-		}
-	}
+	preset := askPreset(reader, settings, editing)
 
 	for {
 		fmt.Println()
-		fmt.Println("Question 3. What's the authentication server's ip address? [" + setting.DEFAULT_AUTH_SERVER + "]")
-		fmt.Println("Hint: You can also write down the server's FQDN if necessary. You may specify either an IPv4 or IPv6 server.")
-		fmt.Println("Hint: The authentication servers of SDU-Qingdao are [2001:250:5800:11::1] and 101.76.193.1.")
-		settings.Account.AuthServer, err = reader.ReadString('\n')
+		fmt.Println(msg("wizard.q3_1", settings.Account.AuthServer))
+		fmt.Println(msg("wizard.q3_1_hint"))
+		if preset != nil && len(preset.Servers) > 0 {
+			fmt.Println(msg("wizard.q3_1_hint_preset", preset.Description, strings.Join(preset.Servers, msg("wizard.q3_1_and"))))
+		}
+		server, err := reader.ReadString('\n')
 		if err != nil {
 			panic(err)
 		}
+		if strings.TrimSpace(server) != "" {
+			settings.Account.AuthServer = server
+		}
 		err = checkAuthServer(settings)
 		if err != nil {
 			fmt.Println(err)
 		} else {
 			if strings.Count(settings.Account.AuthServer, ":") >= 2 {
-				fmt.Println("Hint: Add a pair of [] with the IPv6 address. Omit this hint if you have already done so.")
-				fmt.Println("Example 1 \t [2001:250:5800:11::1]")
-				fmt.Println("Example 2 \t [2001:250:5800:11::1]:8080")
+				fmt.Println(msg("wizard.q3_1_hint_ipv6"))
+				fmt.Println(msg("wizard.example", 1), "\t", "[2001:250:5800:11::1]")
+				fmt.Println(msg("wizard.example", 2), "\t", "[2001:250:5800:11::1]:8080")
 			}
 
 			break
@@ -107,12 +126,17 @@ func cartman() {
 
 	for {
 		fmt.Println()
-		fmt.Println("Question 4. Does the authentication server use HTTP, or HTTPS? [" + setting.DEFAULT_AUTH_SCHEME + "]")
-		fmt.Println("Hint: The authentication servers of SDU-Qingdao use HTTP.")
-		settings.Account.Scheme, err = reader.ReadString('\n')
+		fmt.Println(msg("wizard.q4", settings.Account.Scheme))
+		if preset != nil && preset.Scheme != "" {
+			fmt.Println(msg("wizard.q4_hint_preset", preset.Description, strings.ToUpper(preset.Scheme)))
+		}
+		scheme, err := reader.ReadString('\n')
 		if err != nil {
 			panic(err)
 		}
+		if strings.TrimSpace(scheme) != "" {
+			settings.Account.Scheme = scheme
+		}
 		err = checkScheme(settings)
 		if err != nil {
 			fmt.Println(err)
@@ -139,18 +163,18 @@ func cartman() {
 	//		fmt.Println("All you need to do is to answer me yes or no. Don't be a pussy.")
 	//	}
 	//}
-	if runtime.GOOS == "linux" {
+	{
 		for {
 			fmt.Println()
-			fmt.Println("Question 5. (Linux only)")
+			fmt.Println(msg("wizard.q5"))
 			var ips []string
 			var interfaceStrings []string
 			{
 				var err error
 				var ip string
 				for {
-					var manager *sdunet.Manager
-					manager, err = getManager(context.Background(), settings)
+					var manager *sdunet.Client
+					manager, err = newManager(settings)
 					if err != nil {
 						break
 					}
@@ -164,14 +188,14 @@ func cartman() {
 
 				if err != nil {
 					ip = ""
-					fmt.Println("Warning: Failed to connected to the authentication server.")
+					fmt.Println(msg("wizard.q5_portal_failed"))
 					fmt.Println(err)
 					fmt.Println()
 				}
 
 				ips = append(ips, ip)
 				interfaceStrings = append(interfaceStrings, "")
-				fmt.Println("["+fmt.Sprint(len(ips)-1)+"]", "\t", ip, "\t", "[Auto detect]")
+				fmt.Println("["+fmt.Sprint(len(ips)-1)+"]", "\t", ip, "\t", msg("wizard.q5_auto"))
 			}
 
 			interfaces, err := net.Interfaces()
@@ -191,13 +215,25 @@ func cartman() {
 			// TODO: get an IPv4 and an IPv6 address from each interface
 
 			if len(ips) == 0 {
-				fmt.Println("There is not even a network interface with a valid IPv4 address.")
-				fmt.Println("Screw you guys, I'm going home.")
-				return
+				fmt.Println(msg("wizard.q5_no_interface"))
+				fmt.Println(msg("wizard.q5_give_up"))
+				return nil
 			}
 
-			fmt.Println("Network interfaces are listed above. Which one is connected to the Portal network? [0]")
-			fmt.Println("Hint: It is recommended to choose auto detect. Only choose a specific network interface if you have multiple network interfaces.")
+			defaultChoiceID := 0
+			if settings.Network.StrictMode && settings.Network.Interface != "" {
+				for i, name := range interfaceStrings {
+					if name == settings.Network.Interface {
+						defaultChoiceID = i
+					}
+				}
+				if defaultChoiceID == 0 {
+					fmt.Println(msg("wizard.q5_not_listed", settings.Network.Interface))
+				}
+			}
+
+			fmt.Println(msg("wizard.q5_choose", defaultChoiceID))
+			fmt.Println(msg("wizard.q5_hint"))
 			choice, err := reader.ReadString('\n')
 			if err != nil {
 				panic(err)
@@ -206,7 +242,7 @@ func cartman() {
 
 			var choiceID int
 			if choice == "" {
-				choiceID = 0
+				choiceID = defaultChoiceID
 			} else {
 				choiceID, err = strconv.Atoi(choice)
 				if err != nil {
@@ -215,14 +251,22 @@ func cartman() {
 				}
 			}
 
-			if choiceID == 0 {
+			if choiceID == defaultChoiceID && choice == "" && editing {
+				// keep the current settings, e.g. the bind mode
+			} else if choiceID == 0 {
 				settings.Network.Interface = ""
 				settings.Network.StrictMode = false
 			} else if choiceID > 0 && choiceID < len(interfaceStrings) {
 				settings.Network.Interface = interfaceStrings[choiceID]
 				settings.Network.StrictMode = true
+				// binding to the device requires Linux, while binding to the source address works everywhere
+				if runtime.GOOS == "linux" {
+					settings.Network.BindMode = setting.BIND_MODE_DEVICE
+				} else {
+					settings.Network.BindMode = setting.BIND_MODE_ADDRESS
+				}
 			} else {
-				fmt.Println("Make a valid selection, please. If you are not sure, just hit the enter key to select [0]. You are a fucking asshole.")
+				fmt.Println(msg("wizard.q5_invalid"))
 				continue
 			}
 
@@ -234,34 +278,368 @@ func cartman() {
 		}
 	}
 
+	fmt.Println()
+	if askYesOrNo(reader, msg("wizard.q6"), false) {
+		for {
+			fmt.Println()
+			method := askString(reader, msg("wizard.q6_1"), settings.Control.OnlineDetectionMethod)
+			method = strings.ToLower(method)
+			if method == setting.ONLINE_DETECTION_METHOD_AUTH || method == setting.ONLINE_DETECTION_METHOD_MS {
+				settings.Control.OnlineDetectionMethod = method
+				break
+			}
+			fmt.Println(msg("wizard.q6_1_invalid"))
+		}
+		fmt.Println()
+		settings.Control.LoopIntervalSec = askInt(reader, msg("wizard.q6_2"), settings.Control.LoopIntervalSec, 1)
+		fmt.Println()
+		settings.Control.MaxRetryCount = askInt(reader, msg("wizard.q6_3"), settings.Control.MaxRetryCount, 0)
+		fmt.Println()
+		settings.Control.RetryIntervalSec = askInt(reader, msg("wizard.q6_4"), settings.Control.RetryIntervalSec, 0)
+		fmt.Println()
+		settings.Network.Timeout = askInt(reader, msg("wizard.q6_5"), settings.Network.Timeout, 0)
+		fmt.Println()
+		settings.Network.MaxRetryCount = askInt(reader, msg("wizard.q6_6"), settings.Network.MaxRetryCount, 0)
+		fmt.Println()
+		settings.Network.RetryIntervalSec = askInt(reader, msg("wizard.q6_7"), settings.Network.RetryIntervalSec, 0)
+		fmt.Println()
+		settings.Control.LogoutWhenExit = askYesOrNo(reader, msg("wizard.q6_8"), settings.Control.LogoutWhenExit)
+		askIPSource(reader, settings)
+		if settings.Network.StrictMode && settings.Network.Interface != "" {
+			askBindMode(reader, settings)
+		}
+		askProxy(reader, settings)
+	}
+
+	fmt.Println()
+	if askYesOrNo(reader, msg("wizard.q7"), true) {
+		for verifyCredentials(reader, settings) {
+			fmt.Println()
+			if !askYesOrNo(reader, msg("wizard.q7_reenter"), true) {
+				break
+			}
+			askUsername(reader, settings)
+			askPassword(reader, settings)
+		}
+	}
+
+	if editing && original != nil {
+		current, _ := json.Marshal(settings)
+		if bytes.Equal(original, current) {
+			fmt.Println()
+			fmt.Println(msg("wizard.unchanged", configFile))
+			return nil
+		}
+	}
+
 	{
+		defaultFilename := configFile
+		if defaultFilename == "" {
+			defaultFilename = setting.DEFAULT_CONFIG_FILENAME
+		}
 		fmt.Println()
-		fmt.Println("That's all the information needed. Please save it to a configuration file. Where to save the file? [" + setting.DEFAULT_CONFIG_FILENAME + "]")
-		fmt.Println("Hint: If the program doesn't have permission to write, it will crash.")
+		fmt.Println(msg("wizard.save", defaultFilename))
+		fmt.Println(msg("wizard.save_hint_permission"))
+		fmt.Println(msg("wizard.save_hint_format"))
 		filename, err := reader.ReadString('\n')
 		if err != nil {
-			panic(err)
+			return err
 		}
 		filename = strings.TrimSpace(filename)
 		if filename == "" {
-			filename = setting.DEFAULT_CONFIG_FILENAME
+			filename = defaultFilename
+		}
+		err = setting.SaveSettings(filename, settings)
+		if err != nil {
+			return err
+		}
+		fmt.Println(msg("wizard.saved", filename))
+	}
+	return nil
+}
+
+// askString prints the question with the default answer in the bracket, and returns the answer, or the default one if
+// it is left blank.
+func askString(reader *bufio.Reader, question string, defaultAnswer string) string {
+	fmt.Println(question + " [" + defaultAnswer + "]")
+	answer, err := reader.ReadString('\n')
+	if err != nil {
+		panic(err)
+	}
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return defaultAnswer
+	}
+	return answer
+}
+
+// askInt asks for an integer which is at least min, until a valid one is given.
+func askInt(reader *bufio.Reader, question string, defaultAnswer int32, min int32) int32 {
+	for {
+		answer := askString(reader, question, fmt.Sprint(defaultAnswer))
+		value, err := strconv.ParseInt(answer, 10, 32)
+		if err == nil && int32(value) >= min {
+			return int32(value)
 		}
-		f, err := os.Create(filename)
-		defer f.Close()
+		fmt.Println(msg("wizard.answer_int", min))
+	}
+}
+
+func askYesOrNo(reader *bufio.Reader, question string, defaultAnswer bool) bool {
+	hint := "y/N"
+	if defaultAnswer {
+		hint = "Y/n"
+	}
+	for {
+		fmt.Println(question + " [" + hint + "]")
+		answer, err := reader.ReadString('\n')
+		if err != nil {
+			panic(err)
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "":
+			return defaultAnswer
+		case "y", "yes", "是":
+			return true
+		case "n", "no", "否":
+			return false
+		}
+		fmt.Println(msg("wizard.answer_yes_no"))
+	}
+}
+
+// askIPSource asks where the IP address to log in comes from, and the details of the source.
+func askIPSource(reader *bufio.Reader, settings *setting.Settings) {
+	for {
+		fmt.Println()
+		settings.Network.IPSource = askString(reader, msg("wizard.q6_9"), settings.Network.IPSource)
+		switch strings.ToLower(settings.Network.IPSource) {
+		case setting.IP_SOURCE_INTERFACE:
+			if !settings.Network.StrictMode {
+				settings.Network.Interface = askString(reader, msg("wizard.q6_9_interface"), settings.Network.Interface)
+			}
+		case setting.IP_SOURCE_FIXED:
+			settings.Network.IP = askString(reader, msg("wizard.q6_9_fixed"), settings.Network.IP)
+		case setting.IP_SOURCE_COMMAND:
+			settings.Network.IPCommand = askString(reader, msg("wizard.q6_9_command"), settings.Network.IPCommand)
+		}
+		err := checkIPSource(settings)
+		if err != nil {
+			fmt.Println(err)
+		} else {
+			break
+		}
+	}
+}
+
+func askBindMode(reader *bufio.Reader, settings *setting.Settings) {
+	for {
+		fmt.Println()
+		settings.Network.BindMode = askString(reader, msg("wizard.q6_10"), settings.Network.BindMode)
+		err := checkBindMode(settings)
+		if err != nil {
+			fmt.Println(err)
+		} else {
+			break
+		}
+	}
+}
+
+// askProxy asks for the proxy of the portal requests. The one of the online detection follows it unless set.
+func askProxy(reader *bufio.Reader, settings *setting.Settings) {
+	for {
+		fmt.Println()
+		current := settings.Network.Proxy
+		if current == "" {
+			current = "none"
+		}
+		proxy := askString(reader, msg("wizard.q6_11"), current)
+		if strings.ToLower(proxy) == "none" {
+			proxy = ""
+		}
+		v := &validator{}
+		validateProxy(v, "network.proxy", proxy)
+		if len(v.problems) > 0 {
+			fmt.Println(v.problems[0].Message)
+			continue
+		}
+		settings.Network.Proxy = proxy
+		break
+	}
+}
+
+// setPassword replaces the password of the account. An encrypted password stays encrypted with the same key.
+func setPassword(account *setting.Account, password string) error {
+	password = strings.TrimSpace(password)
+	if account.EncryptedPassword != "" {
+		key, err := setting.LoadKey(account.KeyFile)
+		if err != nil {
+			return err
+		}
+		account.EncryptedPassword, err = setting.EncryptPassword(key, password)
+		return err
+	}
+	account.Password = password
+	account.PasswordFile = ""
+	account.PasswordCommand = ""
+	account.PasswordCredential = ""
+	return nil
+}
+
+func askUsername(reader *bufio.Reader, settings *setting.Settings) {
+	for {
+		fmt.Println()
+		fmt.Println(msg("wizard.q1", settings.Account.Username))
+
+		username, err := reader.ReadString('\n')
+		if err != nil {
+			panic(err)
+		}
+		if strings.TrimSpace(username) != "" {
+			settings.Account.Username = username
+		}
+		err = checkUsername(settings)
 		if err != nil {
 			fmt.Println(err)
 		} else {
-			jsonBytes, err := json.Marshal(settings)
+			break
+		}
+	}
+}
+
+func askPassword(reader *bufio.Reader, settings *setting.Settings) {
+	for {
+		fmt.Println()
+		current := strings.Join(passwordSources(settings.Account), ", ")
+		if current != "" {
+			current = msg("wizard.q2_keep", current)
+		}
+		fmt.Println(msg("wizard.q2", current))
+		bytePassword, err := term.ReadPassword(int(syscall.Stdin))
+		fmt.Println() // it's necessary to add a new line after user's input
+		if err != nil {
+			panic(err)
+		} else if strings.TrimSpace(string(bytePassword)) != "" {
+			err = setPassword(&settings.Account, string(bytePassword))
 			if err != nil {
 				fmt.Println(err)
-			} else {
-				_, err := f.WriteString(string(jsonBytes))
-				if err != nil {
-					fmt.Println(err)
-				} else {
-					fmt.Println(`File saved. You may re-run the program with the "-c" flag. Example: sdunetd -c config.json`)
-				}
+				continue
+			}
+		} else if current != "" {
+			break
+		}
+		err = checkPassword(settings)
+		if err != nil {
+			fmt.Println(err)
+		} else {
+			if len(bytePassword) > 0 {
+				fmt.Println(msg("wizard.q2_length", len(strings.TrimSpace(string(bytePassword)))))
+			}
+			break
+		}
+	}
+}
+
+// verifyCredentials logs in once with the settings and reports the result. It returns true if the portal refuses the
+// username or the password, so that they are worth re-entering.
+func verifyCredentials(reader *bufio.Reader, settings *setting.Settings) bool {
+	ctx := context.Background()
+	d, err := newDaemon(settings)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+
+	info, err := d.client.GetUserInfo(ctx)
+	if err != nil {
+		fmt.Println(msg("wizard.verify_no_connection"))
+		fmt.Println(err)
+		return false
+	}
+	if info.LoggedIn {
+		fmt.Println(msg("wizard.verify_online"))
+		if !askYesOrNo(reader, msg("wizard.verify_login_again"), false) {
+			return false
+		}
+	}
+
+	password, err := resolvePassword(ctx, settings.Account)
+	if err != nil {
+		fmt.Println(msg("wizard.verify_no_password", err))
+		return true
+	}
+	err = d.refreshClientIP(ctx)
+	if err == nil {
+		err = d.client.Login(ctx, password)
+	}
+	if err == nil {
+		fmt.Println(msg("wizard.verify_ok"))
+		return false
+	}
+
+	var portalErr *sdunet.PortalError
+	if !errors.As(err, &portalErr) {
+		fmt.Println(msg("wizard.verify_skipped"))
+		fmt.Println(err)
+		return false
+	}
+	description := describePortalError(portalErr)
+	if description == "" {
+		description = msg("portal.refused")
+	}
+	fmt.Println(msg("wizard.verify_refused", description, portalErr.Error()))
+	switch portalErr.Kind() {
+	case sdunet.KindCredentials, sdunet.KindUnknown:
+		return true
+	case sdunet.KindAlreadyOnline:
+		fmt.Println(msg("wizard.verify_still_online"))
+	}
+	return false
+}
+
+// askPreset offers the presets as a menu, and applies the chosen one. It returns nil if the settings are entered manually.
+func askPreset(reader *bufio.Reader, settings *setting.Settings, editing bool) *setting.Preset {
+	presets := setting.LoadPresets()
+
+	for {
+		fmt.Println()
+		fmt.Println(msg("wizard.q3"))
+		defaultChoiceID := 0
+		fmt.Println("[0]", "\t", msg("wizard.q3_other"))
+		for i, preset := range presets {
+			fmt.Println("["+fmt.Sprint(i+1)+"]", "\t", preset.Name, "\t", preset.Description)
+			if preset.Name == settings.Preset {
+				defaultChoiceID = i + 1
 			}
 		}
+		fmt.Println(msg("wizard.q3_choose", strings.Join(setting.PresetDirs(), ", "), defaultChoiceID))
+		choice, err := reader.ReadString('\n')
+		if err != nil {
+			panic(err)
+		}
+		choice = strings.TrimSpace(choice)
+
+		choiceID := defaultChoiceID
+		if choice != "" {
+			choiceID, err = strconv.Atoi(choice)
+			if err != nil || choiceID < 0 || choiceID > len(presets) {
+				fmt.Println(msg("wizard.invalid_selection"))
+				continue
+			}
+		}
+
+		if choiceID == 0 {
+			settings.Preset = ""
+			return nil
+		}
+		preset := presets[choiceID-1]
+		// keep the current settings, which may differ from the preset on purpose
+		if !(editing && choice == "" && settings.Preset == preset.Name) {
+			preset.Apply(settings)
+		}
+		if preset.Notes != "" {
+			fmt.Println(msg("wizard.q3_note", preset.Notes))
+		}
+		return &preset
 	}
 }
@@ -0,0 +1,268 @@
+/*
+Copyright © 2018-2022 Sad Pencil
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the “Software”), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"github.com/SadPencil/sdunetd/sdunet"
+	"github.com/SadPencil/sdunetd/setting"
+	"github.com/SadPencil/sdunetd/utils"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// daemon owns the portal client, and keeps track of the client IP address so that a renewed DHCP lease is noticed.
+type daemon struct {
+	settings *setting.Settings
+	client   *sdunet.Client
+	// detector sends the online detection probes, which might go via another proxy than the portal requests
+	detector *sdunet.Client
+	clientIP string
+	devices  []*device
+
+	online    bool
+	lastCheck time.Time
+	lastError error
+}
+
+func newDaemon(settings *setting.Settings) (*daemon, error) {
+	client, err := newManager(settings)
+	if err != nil {
+		return nil, err
+	}
+	if settings.Network.TLS.InsecureSkipVerify && len(settings.Network.TLS.PinSHA256) == 0 {
+		logger.Println("Warning: the certificate of the portal is not verified. Consider pinning its fingerprint.")
+	}
+	detector, err := newManager(settings, sdunet.WithProxy(detectionProxy(settings.Network)))
+	if err != nil {
+		return nil, err
+	}
+	d := &daemon{
+		settings: settings,
+		client:   client,
+		detector: detector,
+	}
+	for _, deviceSettings := range settings.Devices {
+		dev, err := newDevice(settings, deviceSettings)
+		if err != nil {
+			return nil, err
+		}
+		d.devices = append(d.devices, dev)
+	}
+	return d, nil
+}
+
+// detectionProxy returns the proxy of the online detection probes, which is the one of the portal requests unless set.
+func detectionProxy(network setting.Network) string {
+	if network.DetectionProxy != "" {
+		return network.DetectionProxy
+	}
+	return network.Proxy
+}
+
+// updateClientIP records the current client IP address, and logs an event if it is changed.
+func (d *daemon) updateClientIP(ip string) {
+	if ip == "" || ip == d.clientIP {
+		return
+	}
+	if d.clientIP == "" {
+		logger.Println("IP address:", ip)
+	} else {
+		logger.Println("IP address changed:", d.clientIP, "->", ip)
+	}
+	d.clientIP = ip
+	d.client.SetClientIP(ip)
+}
+
+// refreshClientIP gets the current client IP address from the configured source. For the portal source, if the portal
+// is unreachable, the address of the network interface is used instead.
+func (d *daemon) refreshClientIP(ctx context.Context) error {
+	var ip string
+	var err error
+	switch d.settings.Network.IPSource {
+	case setting.IP_SOURCE_INTERFACE:
+		ip, err = utils.GetIPv4FromInterface(d.settings.Network.Interface)
+	case setting.IP_SOURCE_FIXED:
+		ip = d.settings.Network.IP
+	case setting.IP_SOURCE_COMMAND:
+		ip, err = utils.GetIPFromCommand(ctx, d.settings.Network.IPCommand)
+	default:
+		var info sdunet.UserInfo
+		info, err = d.client.GetUserInfo(ctx)
+		if err == nil {
+			ip = info.ClientIP
+		} else if d.settings.Network.Interface != "" {
+			verboseLogger.Println("Failed to get the IP address from the portal:", err)
+			ip, err = utils.GetIPv4FromInterface(d.settings.Network.Interface)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	d.updateClientIP(ip)
+	return nil
+}
+
+func (d *daemon) detectNetwork(ctx context.Context) (bool, error) {
+	if d.settings.Control.OnlineDetectionMethod == setting.ONLINE_DETECTION_METHOD_AUTH {
+		return d.detectNetworkWithAuthServer(ctx)
+	} else if d.settings.Control.OnlineDetectionMethod == setting.ONLINE_DETECTION_METHOD_MS {
+		return d.detectNetworkWithMicrosoft(ctx)
+	} else {
+		return d.detectNetworkWithAuthServer(ctx)
+	}
+}
+
+func (d *daemon) detectNetworkWithMicrosoft(ctx context.Context) (bool, error) {
+	client, err := d.detector.GetHttpClient()
+	if err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", "http://www.msftconnecttest.com/connecttest.txt", nil)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+
+	return bytes.Compare(body, []byte("Microsoft Connect Test")) == 0, nil
+}
+
+func (d *daemon) detectNetworkWithAuthServer(ctx context.Context) (bool, error) {
+	info, err := d.detector.GetUserInfo(ctx)
+	if err != nil {
+		return false, err
+	} else {
+		if d.settings.Network.IPSource == setting.IP_SOURCE_PORTAL {
+			d.updateClientIP(info.ClientIP)
+		}
+		return info.LoggedIn, nil
+	}
+}
+
+func (d *daemon) logout(ctx context.Context) error {
+	for _, dev := range d.devices {
+		logger.Println("Logout device", dev.Name, "via web portal...")
+		err := dev.logout(ctx, d.settings)
+		if err != nil {
+			logger.Println(describeError(err))
+		}
+	}
+
+	logger.Println("Logout via web portal...")
+	return retryWithSettings(ctx, d.settings, func() error {
+		err := d.client.Logout(ctx)
+		if err != nil {
+			return err
+		}
+		logger.Println("Logged out.")
+		return nil
+	})
+}
+
+func (d *daemon) login(ctx context.Context) error {
+	logger.Println("Log in via web portal...")
+	return retryWithSettings(ctx, d.settings, func() error {
+		err := d.refreshClientIP(ctx)
+		if err != nil {
+			return err
+		}
+		password, err := resolvePassword(ctx, d.settings.Account)
+		if err != nil {
+			return err
+		}
+		err = d.client.Login(ctx, password)
+		if err != nil {
+			return err
+		}
+		logger.Println("Logged in.")
+		return nil
+	})
+}
+
+func (d *daemon) loginIfNotOnline(ctx context.Context) error {
+	isOnline := false
+	d.lastCheck = time.Now()
+
+	err := retryWithSettings(ctx, d.settings, func() error {
+		var err error
+		isOnline, err = d.detectNetwork(ctx)
+		return err
+	})
+
+	if err == nil && isOnline {
+		logger.Println("Network is up. Nothing to do.")
+		d.online = true
+		d.lastError = nil
+		return nil
+	} else {
+		// not online
+		if err != nil {
+			logger.Println(err)
+		}
+
+		logger.Println("Network is down.")
+		err = d.login(ctx)
+		if err != nil {
+			logger.Println(describeError(err))
+		}
+		d.online = err == nil
+		d.lastError = err
+		return err
+	}
+}
+
+// loginDevicesIfNotOnline keeps every device online.
+func (d *daemon) loginDevicesIfNotOnline(ctx context.Context) {
+	for _, dev := range d.devices {
+		dev.loginIfNotOnline(ctx, d.settings)
+	}
+}
+
+// check keeps the account and the devices online once, and reports their states.
+func (d *daemon) check(ctx context.Context) {
+	_ = d.loginIfNotOnline(ctx)
+	d.loginDevicesIfNotOnline(ctx)
+	if d.settings.Control.StatusFile != "" {
+		if err := d.writeStatus(d.settings.Control.StatusFile); err != nil {
+			logger.Println("Failed to write the status file:", err)
+		}
+	}
+}
+
+// run keeps the network online until ctx is done.
+func (d *daemon) run(ctx context.Context) {
+	d.check(ctx)
+
+	for {
+		canceled := false
+
+		select {
+		case <-time.After(time.Duration(d.settings.Control.LoopIntervalSec) * time.Second):
+			d.check(ctx)
+		case <-ctx.Done():
+			canceled = true
+		}
+
+		if canceled {
+			break
+		}
+	}
+}
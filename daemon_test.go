@@ -0,0 +1,264 @@
+/*
+Copyright © 2018-2022 Sad Pencil
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the “Software”), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/SadPencil/sdunetd/fakeportal"
+	"github.com/SadPencil/sdunetd/setting"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestPortal starts a fake portal, and returns the settings of an account on it. Close the portal after the test.
+func newTestPortal(t *testing.T) (*fakeportal.Portal, *setting.Settings) {
+	portal := fakeportal.NewPortal("10.0.0.2")
+	portal.Logger = log.New(ioutil.Discard, "", 0)
+	addr, err := portal.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings := setting.NewSettings()
+	settings.Account.AuthServer = addr
+	settings.Account.Scheme = "http"
+	settings.Account.Username = "user"
+	settings.Account.Password = "password"
+	settings.Network.MaxRetryCount = 0
+	settings.Control.MaxRetryCount = 0
+	return portal, settings
+}
+
+// newTestProxy starts a forward HTTP proxy, which counts the proxied requests. Close the proxy after the test.
+func newTestProxy() (*httptest.Server, *int32) {
+	var count int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		r.RequestURI = ""
+		resp, err := http.DefaultTransport.RoundTrip(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+		_, _ = io.Copy(w, resp.Body)
+	}))
+	return proxy, &count
+}
+
+func TestDetectionUsesPortalProxy(t *testing.T) {
+	portal, settings := newTestPortal(t)
+	defer portal.Close()
+	portal.SetOnline(true)
+	proxy, count := newTestProxy()
+	defer proxy.Close()
+	settings.Network.Proxy = proxy.URL
+
+	d, err := newDaemon(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.detectNetwork(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(count) == 0 {
+		t.Error("the online detection doesn't go through the proxy of the portal requests")
+	}
+}
+
+func TestRefreshClientIP(t *testing.T) {
+	oldLogger := logger
+	logger = log.New(ioutil.Discard, "", 0)
+	defer func() { logger = oldLogger }()
+	portal, settings := newTestPortal(t)
+	defer portal.Close()
+
+	tests := []struct {
+		name   string
+		modify func(*setting.Network)
+		want   string
+	}{
+		{"portal", func(n *setting.Network) {}, "10.0.0.2"},
+		{"fixed", func(n *setting.Network) {
+			n.IPSource = setting.IP_SOURCE_FIXED
+			n.IP = "10.9.9.9"
+		}, "10.9.9.9"},
+		{"command", func(n *setting.Network) {
+			n.IPSource = setting.IP_SOURCE_COMMAND
+			n.IPCommand = "echo 10.8.8.8"
+		}, "10.8.8.8"},
+		{"failed command", func(n *setting.Network) {
+			n.IPSource = setting.IP_SOURCE_COMMAND
+			n.IPCommand = "exit 1"
+		}, ""},
+		{"command printing no address", func(n *setting.Network) {
+			n.IPSource = setting.IP_SOURCE_COMMAND
+			n.IPCommand = "echo portal"
+		}, ""},
+	}
+	for _, test := range tests {
+		testSettings := *settings
+		test.modify(&testSettings.Network)
+		d, err := newDaemon(&testSettings)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = d.refreshClientIP(context.Background())
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%s: got %s, want an error", test.name, d.clientIP)
+			}
+		} else if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if d.clientIP != test.want {
+			t.Errorf("%s: got %s, want %s", test.name, d.clientIP, test.want)
+		}
+	}
+}
+
+func TestDeviceOfUnknownState(t *testing.T) {
+	portal, settings := newTestPortal(t)
+	defer portal.Close()
+	portal.CallerOnly = true
+	settings.Control.MaxRetryCount = 3
+	settings.Control.RetryIntervalSec = 1
+	settings.Devices = []setting.Device{{IP: "10.0.0.50"}}
+	if err := checkDevices(settings); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := newDaemon(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev := d.devices[0]
+	ctx := context.Background()
+
+	start := time.Now()
+	dev.loginIfNotOnline(ctx, settings)
+	if time.Since(start) >= time.Second {
+		t.Error("the unknown online state is retried")
+	}
+	if !dev.Unknown || !dev.Online || dev.lastLogin.IsZero() {
+		t.Fatalf("the device isn't logged in once after started: %v", dev)
+	}
+
+	lastLogin := dev.lastLogin
+	dev.loginIfNotOnline(ctx, settings)
+	if dev.lastLogin != lastLogin {
+		t.Error("the device is logged in again without relogin_interval_sec")
+	}
+
+	dev.ReloginIntervalSec = 60
+	dev.lastLogin = lastLogin.Add(-time.Minute)
+	dev.loginIfNotOnline(ctx, settings)
+	if !dev.lastLogin.After(lastLogin) {
+		t.Error("the device isn't logged in again after relogin_interval_sec")
+	}
+}
+
+func TestDeviceLogout(t *testing.T) {
+	portal, settings := newTestPortal(t)
+	defer portal.Close()
+	portal.SetOnline(true)
+	settings.Devices = []setting.Device{{IP: "10.0.0.50"}}
+	if err := checkDevices(settings); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := newDaemon(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	dev := d.devices[0]
+	if err := dev.login(ctx, settings); err != nil {
+		t.Fatal(err)
+	}
+	if err := dev.logout(ctx, settings); err != nil {
+		t.Fatal(err)
+	}
+	if !portal.Online() {
+		t.Error("logging out the device logs out the host")
+	}
+	if info, err := d.client.GetUserInfoOf(ctx, dev.IP); err != nil || info.LoggedIn {
+		t.Errorf("the device is still online: %v", err)
+	}
+}
+
+func TestDevicePasswordSource(t *testing.T) {
+	portal, settings := newTestPortal(t)
+	defer portal.Close()
+	settings.Control.MaxRetryCount = 1
+	settings.Devices = []setting.Device{
+		{IP: "10.0.0.50"},
+		{IP: "10.0.0.51", PasswordFile: filepath.Join("nonexistent", "password")},
+	}
+	if err := checkDevices(settings); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := newDaemon(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	// a device without a password source uses the password of the account
+	if err := d.devices[0].login(ctx, settings); err != nil {
+		t.Error(err)
+	}
+	if err := d.devices[1].login(ctx, settings); err == nil {
+		t.Error("the password of the account is used instead of the password file of the device")
+	}
+}
+
+func TestStatusFile(t *testing.T) {
+	portal, settings := newTestPortal(t)
+	defer portal.Close()
+	dir, err := ioutil.TempDir("", "sdunetd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	settings.Control.StatusFile = filepath.Join(dir, "status.json")
+	settings.Devices = []setting.Device{{Name: "printer", IP: "10.0.0.50"}}
+	if err := checkDevices(settings); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := newDaemon(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.check(context.Background())
+
+	content, err := ioutil.ReadFile(settings.Control.StatusFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s status
+	if err := json.Unmarshal(content, &s); err != nil {
+		t.Fatal(err)
+	}
+	if !s.Account.Online || s.Account.IP != "10.0.0.2" {
+		t.Errorf("unexpected status of the account: %+v", s.Account)
+	}
+	if len(s.Devices) != 1 || s.Devices[0].Name != "printer" || !s.Devices[0].Online || s.Devices[0].LastCheck.IsZero() {
+		t.Errorf("unexpected status of the devices: %+v", s.Devices)
+	}
+}
@@ -0,0 +1,153 @@
+/*
+Copyright © 2018-2022 Sad Pencil
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the “Software”), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/SadPencil/sdunetd/sdunet"
+	"github.com/SadPencil/sdunetd/setting"
+	"time"
+)
+
+// device is a LAN device that the daemon logs in on behalf of.
+type device struct {
+	setting.Device
+	client *sdunet.Client
+
+	Online bool
+	// Unknown means the portal can't tell the online state of the device, so Online is the result of the last login.
+	Unknown   bool
+	LastCheck time.Time
+	LastError error
+
+	lastLogin time.Time
+	failures  int
+	nextLogin time.Time
+}
+
+func newDevice(settings *setting.Settings, d setting.Device) (*device, error) {
+	client, err := newManager(settings, sdunet.WithUsername(d.Username), sdunet.WithClientIP(d.IP))
+	if err != nil {
+		return nil, err
+	}
+	return &device{
+		Device: d,
+		client: client,
+	}, nil
+}
+
+func (dev *device) String() string {
+	status := "offline"
+	if dev.Online {
+		status = "online"
+	}
+	if dev.Unknown {
+		status += " (unknown to the portal, as of the last login)"
+	}
+	s := "Device " + dev.Name + " (" + dev.IP + ", " + dev.Username + "): " + status
+	if dev.LastError != nil {
+		s += ", last error: " + describeError(dev.LastError)
+	}
+	return s
+}
+
+func (dev *device) login(ctx context.Context, settings *setting.Settings) error {
+	return retryWithSettings(ctx, settings, func() error {
+		account := settings.Account
+		if len(passwordSources(deviceAccount(dev.Device))) > 0 {
+			account = deviceAccount(dev.Device)
+		}
+		password, err := resolvePassword(ctx, account)
+		if err != nil {
+			return err
+		}
+		return dev.client.Login(ctx, password)
+	})
+}
+
+func (dev *device) logout(ctx context.Context, settings *setting.Settings) error {
+	return retryWithSettings(ctx, settings, func() error {
+		return dev.client.LogoutOf(ctx, dev.IP)
+	})
+}
+
+// loginIfNotOnline checks the online state of the device, and logs it in if necessary. Most portals answer the
+// online state of the caller only, regardless of the IP address asked for. Then the device is logged in once after
+// started, again after ReloginIntervalSec if set, and after a failed login with an exponential backoff.
+func (dev *device) loginIfNotOnline(ctx context.Context, settings *setting.Settings) {
+	now := time.Now()
+	dev.LastCheck = now
+
+	var info sdunet.UserInfo
+	unknown := false
+	err := retryWithSettings(ctx, settings, func() error {
+		var err error
+		info, err = dev.client.GetUserInfoOf(ctx, dev.IP)
+		if errors.Is(err, sdunet.ErrUnexpectedResponse) {
+			// retrying doesn't change the answer
+			unknown = true
+			return nil
+		}
+		return err
+	})
+	dev.Unknown = unknown
+	switch {
+	case unknown:
+		if !dev.shouldLoginBlindly(now) {
+			verboseLogger.Println(dev)
+			return
+		}
+		logger.Println("The portal can't tell the online state of device", dev.Name+". Log in via web portal...")
+	case err == nil && info.LoggedIn:
+		dev.Online = true
+		dev.LastError = nil
+		verboseLogger.Println(dev)
+		return
+	default:
+		if err != nil {
+			verboseLogger.Println("Failed to check the online state of device", dev.Name+":", err)
+		}
+		logger.Println("Device", dev.Name, "is down. Log in via web portal...")
+	}
+
+	err = dev.login(ctx, settings)
+	if err != nil {
+		dev.Online = false
+		dev.LastError = err
+		dev.failures++
+		backoff := time.Duration(settings.Control.LoopIntervalSec) * time.Second
+		for i := 1; i < dev.failures && backoff < maxDeviceBackoff; i++ {
+			backoff *= 2
+		}
+		if backoff > maxDeviceBackoff {
+			backoff = maxDeviceBackoff
+		}
+		dev.nextLogin = now.Add(backoff)
+	} else {
+		dev.Online = true
+		dev.LastError = nil
+		dev.failures = 0
+		dev.lastLogin = now
+	}
+	logger.Println(dev)
+}
+
+// maxDeviceBackoff caps the wait after failed logins of a device whose online state is unknown.
+const maxDeviceBackoff = time.Hour
+
+// shouldLoginBlindly tells whether to log in a device whose online state is unknown.
+func (dev *device) shouldLoginBlindly(now time.Time) bool {
+	if dev.failures > 0 {
+		return !now.Before(dev.nextLogin)
+	}
+	if dev.lastLogin.IsZero() {
+		return true
+	}
+	return dev.ReloginIntervalSec > 0 && now.Sub(dev.lastLogin) >= time.Duration(dev.ReloginIntervalSec)*time.Second
+}
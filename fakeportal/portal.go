@@ -0,0 +1,204 @@
+/*
+Copyright © 2018-2022 Sad Pencil
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the “Software”), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package fakeportal
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// Portal is a minimal SRUN portal that runs on localhost. It answers the same cgi-bin endpoints as the real
+// authentication server, so that the daemon can be exercised off-campus.
+type Portal struct {
+	mu       sync.Mutex
+	sessions map[string]bool
+	staleIPs map[string]bool
+	clientIP string
+	rejects  []string
+
+	Logger *log.Logger
+	// CallerOnly makes rad_user_info answer for the client only and ignore the ip parameter, like most SRUN portals.
+	CallerOnly bool
+
+	listener net.Listener
+	server   *http.Server
+}
+
+func NewPortal(clientIP string) *Portal {
+	return &Portal{
+		sessions: make(map[string]bool),
+		staleIPs: make(map[string]bool),
+		clientIP: clientIP,
+		Logger:   log.Default(),
+	}
+}
+
+// Start listens on a random port of the loopback interface. It returns the address of the portal, e.g. 127.0.0.1:12345.
+func (p *Portal) Start() (string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cgi-bin/rad_user_info", p.handleUserInfo)
+	mux.HandleFunc("/cgi-bin/get_challenge", p.handleChallenge)
+	mux.HandleFunc("/cgi-bin/srun_portal", p.handlePortal)
+
+	p.listener = listener
+	p.server = &http.Server{Handler: mux}
+	go func() {
+		_ = p.server.Serve(listener)
+	}()
+	return listener.Addr().String(), nil
+}
+
+func (p *Portal) Close() error {
+	if p.server == nil {
+		return nil
+	}
+	return p.server.Close()
+}
+
+// SetOnline forcibly changes the online state, as if the session was kicked out by the portal.
+func (p *Portal) SetOnline(online bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sessions[p.clientIP] = online
+}
+
+// SetClientIP changes the IP address of the client, as if the DHCP lease was renewed. The session is dropped.
+func (p *Portal) SetClientIP(ip string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.sessions, p.clientIP)
+	p.staleIPs[p.clientIP] = true
+	delete(p.staleIPs, ip)
+	p.clientIP = ip
+}
+
+// RejectLogin makes the next login request fail with the given SRUN error code, e.g. E2531.
+func (p *Portal) RejectLogin(code string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rejects = append(p.rejects, code)
+}
+
+func (p *Portal) Online() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.sessions[p.clientIP]
+}
+
+func (p *Portal) handleUserInfo(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// like some SRUN deployments, the online state of another address can be queried with the ip parameter
+	ip := r.URL.Query().Get("ip")
+	if ip == "" || p.CallerOnly {
+		ip = p.clientIP
+	}
+	errorStr := "not_online_error"
+	if p.sessions[ip] {
+		errorStr = "ok"
+	}
+	writeJsonp(w, r, map[string]interface{}{
+		"client_ip": p.clientIP,
+		"online_ip": ip,
+		"error":     errorStr,
+	})
+}
+
+func (p *Portal) handleChallenge(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	token := make([]byte, 32)
+	_, _ = rand.Read(token)
+	writeJsonp(w, r, map[string]interface{}{
+		"challenge": hex.EncodeToString(token),
+		"client_ip": p.clientIP,
+		"online_ip": p.clientIP,
+		"error":     "ok",
+		"res":       "ok",
+	})
+}
+
+func (p *Portal) handlePortal(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	query := r.URL.Query()
+	switch query.Get("action") {
+	case "login":
+		if len(p.rejects) > 0 {
+			code := p.rejects[0]
+			p.rejects = p.rejects[1:]
+			p.Logger.Println("Rejected the login request of", query.Get("username"), "with", code)
+			writeJsonp(w, r, map[string]interface{}{
+				"error":     "login_error",
+				"error_msg": code,
+				"res":       "login_error",
+			})
+			return
+		}
+		ip := query.Get("ip")
+		if ip == "" || p.staleIPs[ip] {
+			p.Logger.Println("Rejected the login request of", query.Get("username"), "for a stale IP address", ip)
+			writeJsonp(w, r, map[string]interface{}{
+				"error":     "login_error",
+				"error_msg": "E2833: Your IP address is not in the dhcp table. Maybe you need to renew the IP address.",
+				"res":       "login_error",
+			})
+			return
+		}
+		p.sessions[ip] = true
+		p.Logger.Println("Logged in", query.Get("username"), "at", ip)
+		writeJsonp(w, r, map[string]interface{}{
+			"error":     "ok",
+			"client_ip": p.clientIP,
+			"online_ip": ip,
+			"res":       "ok",
+		})
+	case "logout":
+		ip := query.Get("ip")
+		if ip == "" {
+			ip = p.clientIP
+		}
+		delete(p.sessions, ip)
+		p.Logger.Println("Logged out", query.Get("username"), "at", ip)
+		writeJsonp(w, r, map[string]interface{}{
+			"error": "ok",
+			"res":   "ok",
+		})
+	default:
+		http.Error(w, "unknown action", http.StatusBadRequest)
+	}
+}
+
+func writeJsonp(w http.ResponseWriter, r *http.Request, output map[string]interface{}) {
+	body, err := json.Marshal(output)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	callback := r.URL.Query().Get("callback")
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	if callback != "" {
+		_, _ = w.Write([]byte(callback + "("))
+		_, _ = w.Write(body)
+		_, _ = w.Write([]byte(")"))
+	} else {
+		_, _ = w.Write(body)
+	}
+}
@@ -0,0 +1,131 @@
+/*
+Copyright © 2018-2022 Sad Pencil
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the “Software”), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package fakeportal
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	ACTION_OFFLINE = "offline"
+	ACTION_ONLINE  = "online"
+	ACTION_REJECT  = "reject"
+	ACTION_IP      = "ip"
+)
+
+// Event is a single line of a scenario, e.g. "at 30s offline".
+type Event struct {
+	At     time.Duration
+	Action string
+	Args   []string
+}
+
+func (e Event) String() string {
+	return strings.TrimSpace(fmt.Sprint("at ", e.At, " ", e.Action, " ", strings.Join(e.Args, " ")))
+}
+
+// ParseScenario reads a scenario, one event per line. Empty lines and lines starting with # are ignored.
+//
+//	at 30s offline          # the session is kicked out by the portal
+//	at 40s online           # the session comes back by itself
+//	at 0s reject E2531      # the next login is rejected with the given error code
+//	at 60s ip 10.0.0.5      # the client IP address is changed, and the session is dropped
+func ParseScenario(r io.Reader) ([]Event, error) {
+	var events []Event
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		event, err := parseEvent(fields)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+		}
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].At < events[j].At
+	})
+	return events, nil
+}
+
+func parseEvent(fields []string) (Event, error) {
+	if len(fields) < 3 || fields[0] != "at" {
+		return Event{}, errors.New(`expect "at <time> <action> [args]"`)
+	}
+	at, err := time.ParseDuration(fields[1])
+	if err != nil {
+		return Event{}, err
+	}
+	if at < 0 {
+		return Event{}, errors.New("time should not be negative")
+	}
+	event := Event{At: at, Action: strings.ToLower(fields[2]), Args: fields[3:]}
+
+	switch event.Action {
+	case ACTION_OFFLINE, ACTION_ONLINE:
+		if len(event.Args) != 0 {
+			return Event{}, fmt.Errorf("%s takes no argument", event.Action)
+		}
+	case ACTION_REJECT:
+		if len(event.Args) != 1 {
+			return Event{}, errors.New("reject takes exactly one error code, e.g. E2531")
+		}
+	case ACTION_IP:
+		if len(event.Args) != 1 || net.ParseIP(event.Args[0]) == nil {
+			return Event{}, errors.New("ip takes exactly one IP address")
+		}
+	default:
+		return Event{}, fmt.Errorf("unknown action %q", event.Action)
+	}
+	return event, nil
+}
+
+// RunScenario applies the events to the portal at their time offsets, until all events are applied or ctx is done.
+func RunScenario(ctx context.Context, portal *Portal, events []Event) error {
+	start := time.Now()
+	for _, event := range events {
+		select {
+		case <-time.After(time.Until(start.Add(event.At))):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		portal.Logger.Println("Scenario:", event)
+		switch event.Action {
+		case ACTION_OFFLINE:
+			portal.SetOnline(false)
+		case ACTION_ONLINE:
+			portal.SetOnline(true)
+		case ACTION_REJECT:
+			portal.RejectLogin(event.Args[0])
+		case ACTION_IP:
+			portal.SetClientIP(event.Args[0])
+		}
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ module github.com/SadPencil/sdunetd
 go 1.13
 
 require (
+	github.com/BurntSushi/toml v1.3.2
 	github.com/flowchartsman/retry v1.2.0
 	github.com/hashicorp/go-cleanhttp v0.5.2
 	github.com/hashicorp/go-retryablehttp v0.7.5
@@ -10,4 +11,5 @@ require (
 	golang.org/x/sys v0.14.0
 	golang.org/x/term v0.14.0
 	golang.org/x/text v0.14.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -8,19 +8,17 @@ THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR I
 package main
 
 import (
-	"bytes"
 	"context"
 	"flag"
 	"fmt"
-	"github.com/SadPencil/sdunetd/sdunet"
 	"github.com/SadPencil/sdunetd/setting"
 	"github.com/SadPencil/sdunetd/utils"
 	"github.com/flowchartsman/retry"
 	"io/ioutil"
 	"log"
-	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 )
@@ -33,51 +31,6 @@ func version() {
 	fmt.Println(DESCRIPTION)
 }
 
-func detectNetwork(ctx context.Context, settings *setting.Settings, manager *sdunet.Manager) (bool, error) {
-	if settings.Control.OnlineDetectionMethod == setting.ONLINE_DETECTION_METHOD_AUTH {
-		return detectNetworkWithAuthServer(ctx, manager)
-	} else if settings.Control.OnlineDetectionMethod == setting.ONLINE_DETECTION_METHOD_MS {
-		return detectNetworkWithMicrosoft(ctx, manager)
-	} else {
-		return detectNetworkWithAuthServer(ctx, manager)
-	}
-}
-
-func detectNetworkWithMicrosoft(ctx context.Context, manager *sdunet.Manager) (bool, error) {
-	client, err := manager.GetHttpClient()
-	if err != nil {
-		return false, err
-	}
-
-	req, err := http.NewRequestWithContext(ctx, "GET", "http://www.msftconnecttest.com/connecttest.txt", nil)
-	if err != nil {
-		return false, err
-	}
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return false, err
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return false, err
-	}
-
-	return bytes.Compare(body, []byte("Microsoft Connect Test")) == 0, nil
-}
-
-func detectNetworkWithAuthServer(ctx context.Context, manager *sdunet.Manager) (bool, error) {
-	info, err := manager.GetUserInfo(ctx)
-	if err != nil {
-		return false, err
-	} else {
-		logger.Println("IP address:", info.ClientIP)
-		return info.LoggedIn, nil
-	}
-}
-
 func retryWithSettings(ctx context.Context, settings *setting.Settings, action func() error) error {
 	return _retry(ctx, int(settings.Control.MaxRetryCount), int(settings.Control.RetryIntervalSec), action)
 }
@@ -89,71 +42,9 @@ func _retry(ctx context.Context, retryTimes int, retryIntervalSec int, action fu
 	})
 }
 
-func logout(ctx context.Context, settings *setting.Settings) error {
-	logger.Println("Logout via web portal...")
-	return retryWithSettings(ctx, settings, func() error {
-		manager, err := getManager(ctx, settings)
-		if err != nil {
-			return err
-		}
-		err = manager.Logout(ctx)
-		if err != nil {
-			return err
-		}
-		logger.Println("Logged out.")
-		return nil
-	})
-}
-
-func login(ctx context.Context, settings *setting.Settings) error {
-	logger.Println("Log in via web portal...")
-	return retryWithSettings(ctx, settings, func() error {
-		manager, err := getManager(ctx, settings)
-		if err != nil {
-			return err
-		}
-		err = manager.Login(ctx, settings.Account.Password)
-		if err != nil {
-			return err
-		}
-		logger.Println("Logged in.")
-		return nil
-	})
-}
-
-func loginIfNotOnline(ctx context.Context, settings *setting.Settings) error {
-	isOnline := false
-
-	err := retryWithSettings(ctx, settings, func() error {
-		manager, err := getManager(ctx, settings)
-		if err != nil {
-			return err
-		}
-		isOnline, err = detectNetwork(ctx, settings, manager)
-		return err
-	})
-
-	if err == nil && isOnline {
-		logger.Println("Network is up. Nothing to do.")
-		return nil
-	} else {
-		// not online
-		if err != nil {
-			logger.Println(err)
-		}
-
-		logger.Println("Network is down.")
-		err = login(ctx, settings)
-		if err != nil {
-			logger.Println(err)
-		}
-		return err
-	}
-}
-
 func onExit(action func()) {
 	// set up handler for SIGINT and SIGTERM
-	c := make(chan os.Signal)
+	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 	go func() {
 		for s := range c {
@@ -168,6 +59,11 @@ func onExit(action func()) {
 }
 
 func main() {
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		runCommand(os.Args[1], os.Args[2:])
+		return
+	}
+
 	var FlagShowHelp bool
 	flag.BoolVar(&FlagShowHelp, "h", false, "standalone: show this help.")
 
@@ -198,6 +94,10 @@ func main() {
 	var FlagVerbose bool
 	flag.BoolVar(&FlagVerbose, "v", false, "option: output verbose log")
 
+	registerLanguageFlags(flag.CommandLine)
+
+	flagOverrides := registerOverrideFlags(flag.CommandLine)
+
 	flag.Parse()
 
 	if FlagShowVersion {
@@ -207,6 +107,7 @@ func main() {
 	if FlagShowHelp {
 		version()
 		flag.Usage()
+		printCommands()
 		return
 	}
 
@@ -216,35 +117,33 @@ func main() {
 	}
 
 	if !fileExist {
-		version()
-		cartman()
-		return
+		if !hasOverrides(flagOverrides) {
+			version()
+			err := cartman(FlagConfigFile, true)
+			if err != nil {
+				logger.Println(err)
+				os.Exit(1)
+			}
+			return
+		}
+		if FlagConfigFile != "" {
+			logger.Println(msg("config.file_missing_overrides", FlagConfigFile))
+		}
+		FlagConfigFile = ""
 	}
 
-	settings, err := setting.LoadSettings(FlagConfigFile)
+	settings, err := loadEffectiveSettings(FlagConfigFile, flagOverrides)
 	if err != nil {
-		panic(err)
+		logger.Println(err)
+		os.Exit(1)
 	}
-	//required arguments
-	err = checkInterval(settings)
-	if err != nil {
-		panic(err)
+	problems := validateSettings(FlagConfigFile, settings)
+	for _, p := range problems {
+		logger.Println(p)
 	}
-	err = checkAuthServer(settings)
-	if err != nil {
-		panic(err)
-	}
-	err = checkPassword(settings)
-	if err != nil {
-		panic(err)
-	}
-	err = checkScheme(settings)
-	if err != nil {
-		panic(err)
-	}
-	err = checkUsername(settings)
-	if err != nil {
-		panic(err)
+	if hasErrors(problems) {
+		logger.Println(msg("validate.invalid"))
+		os.Exit(1)
 	}
 
 	//open the log file for writing
@@ -269,13 +168,14 @@ func main() {
 		verboseLogger = logger
 	}
 
+	d, err := newDaemon(settings)
+	if err != nil {
+		logger.Panicln(err)
+	}
+
 	if FlagIPDetect {
 		err := retryWithSettings(context.Background(), settings, func() error {
-			manager, err := getManager(context.Background(), settings)
-			if err != nil {
-				return err
-			}
-			info, err := manager.GetUserInfo(context.Background())
+			info, err := d.client.GetUserInfo(context.Background())
 			if err != nil {
 				return err
 			}
@@ -290,9 +190,9 @@ func main() {
 
 	if FlagOneshoot {
 		version()
-		err := login(context.Background(), settings)
+		err := d.login(context.Background())
 		if err != nil {
-			logger.Panicln(err)
+			logger.Panicln(describeError(err))
 		}
 
 		return
@@ -300,7 +200,7 @@ func main() {
 
 	if FlagTryOneshoot {
 		version()
-		err := loginIfNotOnline(context.Background(), settings)
+		err := d.loginIfNotOnline(context.Background())
 		if err != nil {
 			logger.Panicln(err)
 		}
@@ -309,9 +209,9 @@ func main() {
 
 	if FlagLogout {
 		version()
-		err := logout(context.Background(), settings)
+		err := d.logout(context.Background())
 		if err != nil {
-			logger.Panicln(err)
+			logger.Panicln(describeError(err))
 		}
 		return
 	}
@@ -325,22 +225,7 @@ func main() {
 		cancelFunc()
 	})
 
-	_ = loginIfNotOnline(ctx, settings)
-
-	for {
-		canceled := false
-
-		select {
-		case <-time.After(time.Duration(settings.Control.LoopIntervalSec) * time.Second):
-			_ = loginIfNotOnline(ctx, settings)
-		case <-ctx.Done():
-			canceled = true
-		}
-
-		if canceled {
-			break
-		}
-	}
+	d.run(ctx)
 
 	// Cleanup
 	if settings.Control.LogoutWhenExit {
@@ -349,6 +234,6 @@ func main() {
 			logger.Println("Force exiting. Abort logging out action...")
 			cancelFunc()
 		})
-		_ = logout(ctx, settings)
+		_ = d.logout(ctx)
 	}
 }
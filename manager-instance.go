@@ -1,36 +1,46 @@
 package main
 
 import (
-	"context"
 	"github.com/SadPencil/sdunetd/sdunet"
 	"github.com/SadPencil/sdunetd/setting"
 	"time"
 )
 
-var _manager *sdunet.Manager
-
-func getManager(ctx context.Context, settings *setting.Settings) (*sdunet.Manager, error) {
-	if _manager == nil {
-		networkInterface := ""
-		if settings.Network.StrictMode {
-			networkInterface = settings.Network.Interface
-		}
-
-		manager, err := sdunet.GetManager(ctx,
-			settings.Account.Scheme,
-			settings.Account.AuthServer,
-			settings.Account.Username,
-			networkInterface,
-		)
-		if err != nil {
-			return nil, err
+func newManager(settings *setting.Settings, opts ...sdunet.Option) (*sdunet.Client, error) {
+	var bindOption sdunet.Option = sdunet.WithNetworkInterface("")
+	if settings.Network.StrictMode {
+		if settings.Network.BindMode != setting.BIND_MODE_ADDRESS {
+			bindOption = sdunet.WithNetworkInterface(settings.Network.Interface)
+		} else if settings.Network.BindAddress != "" {
+			bindOption = sdunet.WithSourceAddress(settings.Network.BindAddress)
+		} else {
+			bindOption = sdunet.WithSourceInterface(settings.Network.Interface)
 		}
-		manager.Timeout = time.Duration(settings.Network.Timeout) * time.Second
-		manager.MaxRetryCount = int(settings.Network.MaxRetryCount)
-		manager.RetryWait = time.Duration(settings.Network.RetryIntervalSec) * time.Second
-		manager.Logger = verboseLogger
-
-		_manager = &manager
 	}
-	return _manager, nil
+
+	return sdunet.NewClient(append([]sdunet.Option{
+		sdunet.WithScheme(settings.Account.Scheme),
+		sdunet.WithServer(settings.Account.AuthServer),
+		sdunet.WithAcID(settings.Account.AcID),
+		sdunet.WithUsername(settings.Account.Username),
+		bindOption,
+		sdunet.WithFwMark(settings.Network.FwMark),
+		sdunet.WithTOS(int(settings.Network.TOS)),
+		sdunet.WithNetns(settings.Network.Netns),
+		sdunet.WithDNSServers(settings.Network.DNSServers...),
+		sdunet.WithHosts(settings.Network.Hosts),
+		sdunet.WithTLS(sdunet.TLSOptions{
+			CAFile:             settings.Network.TLS.CAFile,
+			PinSHA256:          settings.Network.TLS.PinSHA256,
+			ServerName:         settings.Network.TLS.ServerName,
+			MinVersion:         tlsVersions[settings.Network.TLS.MinVersion],
+			InsecureSkipVerify: settings.Network.TLS.InsecureSkipVerify,
+		}),
+		sdunet.WithTimeout(time.Duration(settings.Network.Timeout) * time.Second),
+		sdunet.WithRetry(int(settings.Network.MaxRetryCount), time.Duration(settings.Network.RetryIntervalSec)*time.Second),
+		sdunet.WithProxy(settings.Network.Proxy),
+		sdunet.WithUserAgent(settings.Network.UserAgent),
+		sdunet.WithHeaders(settings.Network.Headers),
+		sdunet.WithLogger(verboseLogger),
+	}, opts...)...)
 }
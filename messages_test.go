@@ -0,0 +1,115 @@
+/*
+Copyright © 2018-2022 Sad Pencil
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the “Software”), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package main
+
+import (
+	"github.com/SadPencil/sdunetd/sdunet"
+	"github.com/SadPencil/sdunetd/setting"
+	"regexp"
+	"testing"
+)
+
+var verbPattern = regexp.MustCompile(`%[vsd]`)
+
+func TestCatalogIsComplete(t *testing.T) {
+	for key, translation := range catalog {
+		if translation.EN == "" || translation.ZH == "" {
+			t.Errorf("%s: a translation is missing", key)
+			continue
+		}
+		verbs := len(verbPattern.FindAllString(translation.EN, -1))
+		if n := len(verbPattern.FindAllString(translation.ZH, -1)); n != verbs {
+			t.Errorf("%s: zh-CN has %d arguments, but en has %d", key, n, verbs)
+		}
+		if translation.Playful != "" {
+			if n := len(verbPattern.FindAllString(translation.Playful, -1)); n != verbs {
+				t.Errorf("%s: the playful tone has %d arguments, but en has %d", key, n, verbs)
+			}
+		}
+	}
+}
+
+func TestPackageMessagesAreTranslated(t *testing.T) {
+	english := make(map[string]string)
+	for _, code := range sdunet.PortalErrorCodes() {
+		english["portal."+code] = (&sdunet.PortalError{Code: code}).Description()
+	}
+	for key, message := range setting.Messages {
+		english["setting."+key] = message
+	}
+	for key, message := range english {
+		zh, ok := translationsZH[key]
+		if !ok {
+			t.Errorf("%s: the zh-CN translation is missing", key)
+			continue
+		}
+		verbs := len(verbPattern.FindAllString(message, -1))
+		if n := len(verbPattern.FindAllString(zh, -1)); n != verbs {
+			t.Errorf("%s: zh-CN has %d arguments, but en has %d", key, n, verbs)
+		}
+	}
+	for key := range translationsZH {
+		if _, ok := english[key]; !ok {
+			t.Errorf("%s: there is no such message", key)
+		}
+	}
+}
+
+func TestTone(t *testing.T) {
+	defer func(saved string, savedTone bool) { language, playfulTone = saved, savedTone }(language, playfulTone)
+
+	language, playfulTone = LANG_EN, false
+	if got, want := msg("check.username_empty"), "The username is required."; got != want {
+		t.Errorf("the default tone: msg() = %q, want %q", got, want)
+	}
+	playfulTone = true
+	if got, want := msg("check.username_empty"), catalog["check.username_empty"].Playful; got != want {
+		t.Errorf("the playful tone: msg() = %q, want %q", got, want)
+	}
+	language = LANG_ZH_CN
+	if got, want := msg("check.username_empty"), catalog["check.username_empty"].ZH; got != want {
+		t.Errorf("the playful tone in Chinese: msg() = %q, want %q", got, want)
+	}
+}
+
+func TestDescribePortalError(t *testing.T) {
+	defer func(saved string) { language = saved }(language)
+
+	err := &sdunet.PortalError{Code: "login_error", Message: "E2553: Password is error."}
+	language = LANG_EN
+	if got, want := describeError(err), "the password is wrong (login_error: E2553: Password is error.)"; got != want {
+		t.Errorf("describeError() = %q, want %q", got, want)
+	}
+	language = LANG_ZH_CN
+	if got, want := describeError(err), "密码错误 (login_error: E2553: Password is error.)"; got != want {
+		t.Errorf("describeError() = %q, want %q", got, want)
+	}
+	unknown := &sdunet.PortalError{Code: "login_error", Message: "E9999: Something."}
+	if got, want := describeError(unknown), unknown.Error(); got != want {
+		t.Errorf("describeError() = %q, want %q", got, want)
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		env  map[string]string
+		want string
+	}{
+		{map[string]string{}, LANG_EN},
+		{map[string]string{"LANG": "C"}, LANG_EN},
+		{map[string]string{"LANG": "zh_CN.UTF-8"}, LANG_ZH_CN},
+		{map[string]string{"LANG": "zh_CN.UTF-8", "LC_ALL": "en_US.UTF-8"}, LANG_EN},
+		{map[string]string{"LC_ALL": "en_US.UTF-8", "SDUNETD_LANG": "zh-CN"}, LANG_ZH_CN},
+	}
+	for _, test := range tests {
+		getenv := func(name string) string { return test.env[name] }
+		if got := detectLanguage(getenv); got != test.want {
+			t.Errorf("detectLanguage(%v) = %s, want %s", test.env, got, test.want)
+		}
+	}
+}
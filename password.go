@@ -0,0 +1,111 @@
+/*
+Copyright © 2018-2022 Sad Pencil
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the “Software”), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/SadPencil/sdunetd/setting"
+	"github.com/SadPencil/sdunetd/utils"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// passwordSources lists the configured sources of the password by their setting names.
+func passwordSources(account setting.Account) []string {
+	var sources []string
+	if account.Password != "" {
+		sources = append(sources, "password")
+	}
+	if account.PasswordFile != "" {
+		sources = append(sources, "password_file")
+	}
+	if account.PasswordCommand != "" {
+		sources = append(sources, "password_command")
+	}
+	if account.PasswordCredential != "" {
+		sources = append(sources, "password_credential")
+	}
+	if account.EncryptedPassword != "" {
+		sources = append(sources, "encrypted_password")
+	}
+	return sources
+}
+
+// deviceAccount returns the password sources of the device as an account, so that they are resolved like the ones of
+// the account.
+func deviceAccount(device setting.Device) setting.Account {
+	return setting.Account{
+		Username:           device.Username,
+		Password:           device.Password,
+		PasswordFile:       device.PasswordFile,
+		PasswordCommand:    device.PasswordCommand,
+		PasswordCredential: device.PasswordCredential,
+		EncryptedPassword:  device.EncryptedPassword,
+		KeyFile:            device.KeyFile,
+	}
+}
+
+// setDevicePasswordSources replaces the password sources of the device with the ones of the account.
+func setDevicePasswordSources(device *setting.Device, account setting.Account) {
+	device.Password = account.Password
+	device.PasswordFile = account.PasswordFile
+	device.PasswordCommand = account.PasswordCommand
+	device.PasswordCredential = account.PasswordCredential
+	device.EncryptedPassword = account.EncryptedPassword
+	device.KeyFile = account.KeyFile
+}
+
+// resolvePassword reads the password from its source. Only the first line of a file or a command output is used, like
+// what "pass show" prints. The spaces around it are trimmed, like the plaintext password by checkPassword.
+func resolvePassword(ctx context.Context, account setting.Account) (string, error) {
+	var password string
+	switch {
+	case account.Password != "":
+		return account.Password, nil
+	case account.PasswordFile != "":
+		content, err := ioutil.ReadFile(account.PasswordFile)
+		if err != nil {
+			return "", err
+		}
+		password = string(content)
+	case account.PasswordCommand != "":
+		output, err := utils.GetOutputOfCommand(ctx, account.PasswordCommand)
+		if err != nil {
+			return "", errors.New("failed to run the password command: " + err.Error())
+		}
+		password = output
+	case account.PasswordCredential != "":
+		// systemd passes the credentials of LoadCredential= in this directory
+		dir := os.Getenv("CREDENTIALS_DIRECTORY")
+		if dir == "" {
+			return "", errors.New("$CREDENTIALS_DIRECTORY is not set. Is LoadCredential= given in the systemd unit?")
+		}
+		content, err := ioutil.ReadFile(filepath.Join(dir, account.PasswordCredential))
+		if err != nil {
+			return "", err
+		}
+		password = string(content)
+	case account.EncryptedPassword != "":
+		key, err := setting.LoadKey(account.KeyFile)
+		if err != nil {
+			return "", err
+		}
+		return setting.DecryptPassword(key, account.EncryptedPassword)
+	default:
+		return "", errors.New("no password is configured")
+	}
+
+	password = strings.TrimSpace(strings.SplitN(strings.TrimSpace(password), "\n", 2)[0])
+	if password == "" {
+		return "", errors.New("the password is empty")
+	}
+	return password, nil
+}
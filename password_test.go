@@ -0,0 +1,72 @@
+/*
+Copyright © 2018-2022 Sad Pencil
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the “Software”), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package main
+
+import (
+	"context"
+	"github.com/SadPencil/sdunetd/setting"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestResolvePasswordTrimsSpaces(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sdunetd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"secret", "secret"},
+		{"secret\n", "secret"},
+		{"secret\r\n", "secret"},
+		{" secret \t\r\nsecond line\n", "secret"},
+		{"\n\n  secret\n", "secret"},
+		{"pass word\n", "pass word"},
+	}
+	for i, test := range tests {
+		passwordFile := filepath.Join(dir, "password")
+		err := ioutil.WriteFile(passwordFile, []byte(test.content), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		password, err := resolvePassword(context.Background(), setting.Account{PasswordFile: passwordFile})
+		if err != nil {
+			t.Errorf("%d: %v", i, err)
+		} else if password != test.want {
+			t.Errorf("%d: got %q, want %q", i, password, test.want)
+		}
+	}
+
+	err = ioutil.WriteFile(filepath.Join(dir, "password"), []byte(" \r\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := resolvePassword(context.Background(), setting.Account{PasswordFile: filepath.Join(dir, "password")}); err == nil {
+		t.Error("a blank password file is accepted")
+	}
+}
+
+func TestResolvePasswordFromCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the command is run by sh")
+	}
+	password, err := resolvePassword(context.Background(), setting.Account{PasswordCommand: `printf ' secret \r\nsecond line\n'`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if password != "secret" {
+		t.Errorf("got %q, want secret", password)
+	}
+}
@@ -9,7 +9,7 @@ package sdunet
 
 import "github.com/robertkrimen/otto"
 
-func sdunetChallenge(username, password, localIP, token string, dataInfoStr, dataPasswordMd5Str, dataChecksumStr *string) (err error) {
+func sdunetChallenge(username, password, localIP, acID, token string, dataInfoStr, dataPasswordMd5Str, dataChecksumStr *string) (err error) {
 	vm := otto.New()
 
 	err = vm.Set("input_username", username)
@@ -26,7 +26,7 @@ func sdunetChallenge(username, password, localIP, token string, dataInfoStr, dat
 		return err
 	}
 
-	err = vm.Set("input_ac_id", 1)
+	err = vm.Set("input_ac_id", acID)
 	if err != nil {
 		return err
 	}
@@ -113,14 +113,14 @@ function getDataInfo(username, password, ip, token) {
 
     var base64 = new Hashes.Base64();
     return "{SRBX1}" + base64.encode(xEncode("{\"username\":" + JSON.stringify(username)+",\"password\":"+JSON.stringify(password)+",\"ip\":"
-+JSON.stringify(ip)+",\"acid\":\"1\",\"enc_ver\":\"srun_bx1\"}", token));
++JSON.stringify(ip)+",\"acid\":"+JSON.stringify(input_ac_id)+",\"enc_ver\":\"srun_bx1\"}", token));
 }
 
 
 function getDataChecksum(username, ip, token, datainfo, dataMd5) {
     var n = 200,
         type = 1;
-    return new Hashes.SHA1().hex(token + username + token + dataMd5 + token + "1" + token + ip + token + n + token + type + token + datainfo);
+    return new Hashes.SHA1().hex(token + username + token + dataMd5 + token + input_ac_id + token + ip + token + n + token + type + token + datainfo);
 }
 
 function getHmd5(password,token){
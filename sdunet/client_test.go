@@ -0,0 +1,321 @@
+/*
+Copyright © 2018-2022 Sad Pencil
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the “Software”), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package sdunet_test
+
+import (
+	"context"
+	"errors"
+	"github.com/SadPencil/sdunetd/fakeportal"
+	"github.com/SadPencil/sdunetd/sdunet"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// startPortal starts a fake portal for the client IP address. The caller closes it.
+func startPortal(t *testing.T, clientIP string) (*fakeportal.Portal, string) {
+	portal := fakeportal.NewPortal(clientIP)
+	portal.Logger = log.New(ioutil.Discard, "", 0)
+	addr, err := portal.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return portal, addr
+}
+
+// countingTransport counts the requests, to tell whether the client touches the network.
+type countingTransport struct {
+	requests int32
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&c.requests, 1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func newTestClient(t *testing.T, server string, opts ...sdunet.Option) *sdunet.Client {
+	opts = append([]sdunet.Option{
+		sdunet.WithServer(server),
+		sdunet.WithUsername("201800000000"),
+		sdunet.WithRetry(0, 0),
+	}, opts...)
+	client, err := sdunet.NewClient(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestLogin(t *testing.T) {
+	portal, addr := startPortal(t, "10.0.0.2")
+	defer portal.Close()
+	client := newTestClient(t, addr)
+	ctx := context.Background()
+
+	info, err := client.GetUserInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.LoggedIn || info.ClientIP != "10.0.0.2" {
+		t.Errorf("before the login: got %+v", info)
+	}
+
+	err = client.Login(ctx, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !portal.Online() {
+		t.Error("the portal doesn't see the login")
+	}
+	info, err = client.GetUserInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.LoggedIn || info.ClientIP != "10.0.0.2" {
+		t.Errorf("after the login: got %+v", info)
+	}
+
+	err = client.Logout(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if portal.Online() {
+		t.Error("the portal doesn't see the logout")
+	}
+}
+
+func TestClientIPIsDiscoveredLazily(t *testing.T) {
+	portal, addr := startPortal(t, "10.0.0.2")
+	defer portal.Close()
+	transport := &countingTransport{}
+	client := newTestClient(t, addr, sdunet.WithTransport(transport))
+	ctx := context.Background()
+
+	if n := atomic.LoadInt32(&transport.requests); n != 0 {
+		t.Errorf("NewClient sends %d requests", n)
+	}
+	// the address at the first use is discovered, and kept afterwards
+	portal.SetClientIP("10.0.0.3")
+	ip, err := client.ClientIP(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip != "10.0.0.3" {
+		t.Errorf("discovered %s, want 10.0.0.3", ip)
+	}
+	portal.SetClientIP("10.0.0.4")
+	ip, err = client.ClientIP(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip != "10.0.0.3" {
+		t.Errorf("rediscovered %s, want the kept 10.0.0.3", ip)
+	}
+	if n := atomic.LoadInt32(&transport.requests); n != 1 {
+		t.Errorf("the discovery sends %d requests, want 1", n)
+	}
+
+	// a stale address is refused until it is updated
+	err = client.Login(ctx, "password")
+	var portalErr *sdunet.PortalError
+	if !errors.As(err, &portalErr) || portalErr.Kind() != sdunet.KindWrongIP {
+		t.Errorf("login with a stale address: got %v, want E2833", err)
+	}
+	client.SetClientIP("10.0.0.4")
+	err = client.Login(ctx, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !portal.Online() {
+		t.Error("the portal doesn't see the login")
+	}
+}
+
+func TestWithClientIPSkipsTheDiscovery(t *testing.T) {
+	portal, addr := startPortal(t, "10.0.0.2")
+	defer portal.Close()
+	transport := &countingTransport{}
+	client := newTestClient(t, addr, sdunet.WithTransport(transport), sdunet.WithClientIP("10.0.0.50"))
+
+	ip, err := client.ClientIP(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip != "10.0.0.50" {
+		t.Errorf("got %s, want 10.0.0.50", ip)
+	}
+	if n := atomic.LoadInt32(&transport.requests); n != 0 {
+		t.Errorf("the client sends %d requests", n)
+	}
+}
+
+func TestPortalError(t *testing.T) {
+	portal, addr := startPortal(t, "10.0.0.2")
+	defer portal.Close()
+	client := newTestClient(t, addr)
+
+	portal.RejectLogin("E2553: Password is error.")
+	err := client.Login(context.Background(), "wrong")
+	var portalErr *sdunet.PortalError
+	if !errors.As(err, &portalErr) {
+		t.Fatalf("got %v, want *PortalError", err)
+	}
+	if portalErr.Action != "login" || portalErr.Code != "login_error" || portalErr.Message != "E2553: Password is error." {
+		t.Errorf("got %+v", portalErr)
+	}
+	if portalErr.ErrorCode() != "E2553" || portalErr.Kind() != sdunet.KindCredentials || portalErr.Description() == "" {
+		t.Errorf("E2553 is classified as %s, %v, %q", portalErr.ErrorCode(), portalErr.Kind(), portalErr.Description())
+	}
+	if portal.Online() {
+		t.Error("the rejected login is online")
+	}
+}
+
+func TestPortalErrorCode(t *testing.T) {
+	tests := []struct {
+		err  sdunet.PortalError
+		code string
+		kind sdunet.PortalErrorKind
+	}{
+		{sdunet.PortalError{Code: "login_error", Message: "E2531: User not found."}, "E2531", sdunet.KindCredentials},
+		{sdunet.PortalError{Code: "login_error", Message: " E2616: Arrearage users."}, "E2616", sdunet.KindAccount},
+		{sdunet.PortalError{Code: "ip_already_online_error"}, "ip_already_online_error", sdunet.KindAlreadyOnline},
+		{sdunet.PortalError{Code: "login_error", Message: "Error: unknown."}, "login_error", sdunet.KindUnknown},
+		{sdunet.PortalError{Code: "login_error", Message: "E25"}, "login_error", sdunet.KindUnknown},
+	}
+	for _, test := range tests {
+		if code := test.err.ErrorCode(); code != test.code {
+			t.Errorf("%v: ErrorCode() = %s, want %s", &test.err, code, test.code)
+		}
+		if kind := test.err.Kind(); kind != test.kind {
+			t.Errorf("%v: Kind() = %v, want %v", &test.err, kind, test.kind)
+		}
+	}
+}
+
+func TestStatusError(t *testing.T) {
+	for _, status := range []int{http.StatusNotFound, http.StatusBadGateway} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		}))
+		client := newTestClient(t, server.Listener.Addr().String())
+		_, err := client.GetUserInfo(context.Background())
+		server.Close()
+
+		var statusErr *sdunet.StatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != status {
+			t.Errorf("status %d: got %v, want *StatusError", status, err)
+		}
+	}
+}
+
+func TestUnexpectedResponse(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"not JSON", "<html>Welcome</html>"},
+		{"missing fields", `jQuery({"res": "ok"})`},
+	}
+	for _, test := range tests {
+		body := test.body
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(body))
+		}))
+		client := newTestClient(t, server.Listener.Addr().String())
+		_, err := client.GetUserInfo(context.Background())
+		server.Close()
+
+		if !errors.Is(err, sdunet.ErrUnexpectedResponse) {
+			t.Errorf("%s: got %v, want ErrUnexpectedResponse", test.name, err)
+		}
+	}
+}
+
+func TestGetUserInfoOf(t *testing.T) {
+	for _, callerOnly := range []bool{false, true} {
+		portal := fakeportal.NewPortal("10.0.0.2")
+		portal.Logger = log.New(ioutil.Discard, "", 0)
+		// most portals answer for the caller only
+		portal.CallerOnly = callerOnly
+		addr, err := portal.Start()
+		if err != nil {
+			t.Fatal(err)
+		}
+		device := newTestClient(t, addr, sdunet.WithClientIP("10.0.0.50"))
+		client := newTestClient(t, addr)
+		ctx := context.Background()
+
+		err = device.Login(ctx, "password")
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := client.GetUserInfoOf(ctx, "10.0.0.50")
+		_ = portal.Close()
+		if callerOnly {
+			if !errors.Is(err, sdunet.ErrUnexpectedResponse) {
+				t.Errorf("a portal answering for the caller only: got %v, want ErrUnexpectedResponse", err)
+			}
+		} else if err != nil || !info.LoggedIn || info.ClientIP != "10.0.0.50" {
+			t.Errorf("got %+v, %v", info, err)
+		}
+	}
+}
+
+func TestNewClientOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []sdunet.Option
+	}{
+		{"no server", nil},
+		{"unknown scheme", []sdunet.Option{sdunet.WithServer("10.0.0.1"), sdunet.WithScheme("ftp")}},
+		{"negative timeout", []sdunet.Option{sdunet.WithServer("10.0.0.1"), sdunet.WithTimeout(-1)}},
+		{"invalid proxy", []sdunet.Option{sdunet.WithServer("10.0.0.1"), sdunet.WithProxy("ftp://10.0.0.2")}},
+	}
+	for _, test := range tests {
+		_, err := sdunet.NewClient(test.opts...)
+		if !errors.Is(err, sdunet.ErrInvalidOption) {
+			t.Errorf("%s: got %v, want ErrInvalidOption", test.name, err)
+		}
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	var userAgent atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent.Store(r.Header.Get("User-Agent"))
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name string
+		opts []sdunet.Option
+		want string
+	}{
+		{"preset", []sdunet.Option{sdunet.WithUserAgent("chrome")}, sdunet.UserAgentPresets["chrome"]},
+		{"preset in another case", []sdunet.Option{sdunet.WithUserAgent("Firefox")}, sdunet.UserAgentPresets["firefox"]},
+		{"custom", []sdunet.Option{sdunet.WithUserAgent("curl/8.0")}, "curl/8.0"},
+		{"header", []sdunet.Option{sdunet.WithHeaders(map[string]string{"User-Agent": "curl/8.0"})}, "curl/8.0"},
+		{"over the header", []sdunet.Option{
+			sdunet.WithHeaders(map[string]string{"User-Agent": "curl/8.0"}),
+			sdunet.WithUserAgent("iphone"),
+		}, sdunet.UserAgentPresets["iphone"]},
+		{"default", nil, "Go-http-client/1.1"},
+	}
+	for _, test := range tests {
+		client := newTestClient(t, server.Listener.Addr().String(), test.opts...)
+		_, _ = client.GetUserInfo(context.Background())
+		if got, _ := userAgent.Load().(string); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+/*
+Copyright © 2018-2022 Sad Pencil
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the “Software”), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package sdunet
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidOption is wrapped by the errors returned from NewClient when an option is missing or invalid.
+	ErrInvalidOption = errors.New("sdunet: invalid option")
+
+	// ErrUnexpectedResponse is wrapped by the errors returned when the portal answers with an unknown format.
+	ErrUnexpectedResponse = errors.New("sdunet: unexpected response from the portal")
+)
+
+// PortalError is returned when the portal refuses a request, e.g. a login with a wrong password.
+type PortalError struct {
+	// Action is the requested action, e.g. login or logout.
+	Action string
+	// Code is the "error" field of the response, e.g. login_error.
+	Code string
+	// Message is the "error_msg" field of the response, e.g. E2531: User not found. It may be empty.
+	Message string
+}
+
+func (e *PortalError) Error() string {
+	if e.Message == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Message
+}
+
+// PortalErrorKind classifies a PortalError by the SRUN error code.
+type PortalErrorKind int
+
+const (
+	// KindUnknown is a refusal without a known error code.
+	KindUnknown PortalErrorKind = iota
+	// KindCredentials means the username or the password is wrong.
+	KindCredentials
+	// KindAccount means the account can't log in now, e.g. it is disabled or out of balance.
+	KindAccount
+	// KindAlreadyOnline means the IP address or the account is already online.
+	KindAlreadyOnline
+	// KindTooFrequent means the requests are too frequent.
+	KindTooFrequent
+	// KindWrongIP means the IP address in the request is not the one the portal sees.
+	KindWrongIP
+)
+
+type portalErrorCode struct {
+	kind        PortalErrorKind
+	description string
+}
+
+// portalErrorCodes are the common error codes of SRUN portals, found at the beginning of the messages or in the
+// error field.
+var portalErrorCodes = map[string]portalErrorCode{
+	"E2531":                   {KindCredentials, "the user is not found"},
+	"E2553":                   {KindCredentials, "the password is wrong"},
+	"E2901":                   {KindCredentials, "the username or the password is wrong"},
+	"E2606":                   {KindAccount, "the user is disabled"},
+	"E2616":                   {KindAccount, "the account is out of balance"},
+	"E2620":                   {KindAlreadyOnline, "the account is already online"},
+	"ip_already_online_error": {KindAlreadyOnline, "the IP address is already online"},
+	"E2532":                   {KindTooFrequent, "the logins are too frequent"},
+	"E2833":                   {KindWrongIP, "the IP address is not the one of this device"},
+}
+
+// PortalErrorCodes returns the error codes that Description explains, e.g. to translate the descriptions.
+func PortalErrorCodes() []string {
+	codes := make([]string, 0, len(portalErrorCodes))
+	for code := range portalErrorCodes {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// ErrorCode returns the SRUN error code of the refusal, e.g. E2531, or the error field if there is no code in the message.
+func (e *PortalError) ErrorCode() string {
+	message := strings.TrimSpace(e.Message)
+	if len(message) >= 5 && message[0] == 'E' {
+		code := message[:5]
+		if _, err := strconv.Atoi(code[1:]); err == nil {
+			return code
+		}
+	}
+	return e.Code
+}
+
+// Kind classifies the refusal by its error code.
+func (e *PortalError) Kind() PortalErrorKind {
+	return portalErrorCodes[e.ErrorCode()].kind
+}
+
+// Description explains the error code in English, or returns an empty string if the code is unknown.
+func (e *PortalError) Description() string {
+	return portalErrorCodes[e.ErrorCode()].description
+}
+
+// StatusError is returned when the portal answers with an HTTP status other than 200 OK.
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return e.Status
+}
+
+func unexpectedResponse(format string, a ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrUnexpectedResponse, fmt.Sprintf(format, a...))
+}
+
+func invalidOption(format string, a ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidOption, fmt.Sprintf(format, a...))
+}
@@ -0,0 +1,125 @@
+/*
+Copyright © 2018-2022 Sad Pencil
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the “Software”), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package sdunet_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/SadPencil/sdunetd/fakeportal"
+	"github.com/SadPencil/sdunetd/sdunet"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+)
+
+// startExamplePortal starts a fake portal on localhost in place of the authentication server, e.g. 101.76.193.1.
+func startExamplePortal() (*fakeportal.Portal, string) {
+	portal := fakeportal.NewPortal("10.0.0.2")
+	portal.Logger = log.New(ioutil.Discard, "", 0)
+	server, err := portal.Start()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return portal, server
+}
+
+func ExampleNewClient() {
+	portal, server := startExamplePortal()
+	defer portal.Close()
+
+	client, err := sdunet.NewClient(
+		sdunet.WithServer(server),
+		sdunet.WithUsername("201800000000"),
+		sdunet.WithTimeout(5*time.Second),
+		sdunet.WithRetry(3, time.Second),
+		sdunet.WithLogger(log.New(os.Stderr, "sdunet: ", log.LstdFlags)),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+	info, err := client.GetUserInfo(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("online:", info.LoggedIn)
+	if !info.LoggedIn {
+		err = client.Login(ctx, "password")
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	info, err = client.GetUserInfo(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("online:", info.LoggedIn, "at", info.ClientIP)
+	// Output:
+	// online: false
+	// online: true at 10.0.0.2
+}
+
+func ExamplePortalError() {
+	portal, server := startExamplePortal()
+	defer portal.Close()
+	portal.RejectLogin("E2553: Password is error.")
+
+	client, err := sdunet.NewClient(
+		sdunet.WithServer(server),
+		sdunet.WithUsername("201800000000"),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = client.Login(context.Background(), "wrong password")
+	var portalErr *sdunet.PortalError
+	if errors.As(err, &portalErr) {
+		fmt.Println("The portal refused to log in:", portalErr.Message)
+		fmt.Println(portalErr.ErrorCode()+":", portalErr.Description())
+		fmt.Println("Wrong credentials:", portalErr.Kind() == sdunet.KindCredentials)
+	}
+	// Output:
+	// The portal refused to log in: E2553: Password is error.
+	// E2553: the password is wrong
+	// Wrong credentials: true
+}
+
+func ExampleWithClientIP() {
+	portal, server := startExamplePortal()
+	defer portal.Close()
+
+	// Log in another device behind this host, skipping the discovery of the client IP address.
+	client, err := sdunet.NewClient(
+		sdunet.WithServer(server),
+		sdunet.WithUsername("201800000000"),
+		sdunet.WithClientIP("10.0.0.5"),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx := context.Background()
+	err = client.Login(ctx, "password")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Not every portal answers for another address. Then an error wrapping ErrUnexpectedResponse is returned.
+	info, err := client.GetUserInfoOf(ctx, "10.0.0.5")
+	if errors.Is(err, sdunet.ErrUnexpectedResponse) {
+		fmt.Println("The online state of the device is unknown.")
+	} else if err != nil {
+		log.Fatal(err)
+	} else {
+		fmt.Println("online:", info.LoggedIn, "at", info.ClientIP)
+	}
+	// Output:
+	// online: true at 10.0.0.5
+}
@@ -0,0 +1,202 @@
+/*
+Copyright © 2018-2022 Sad Pencil
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the “Software”), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package sdunet
+
+import (
+	"context"
+	"errors"
+	"github.com/SadPencil/sdunetd/utils"
+	"github.com/hashicorp/go-cleanhttp"
+	retryableHttp "github.com/hashicorp/go-retryablehttp"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+type httpClientConfig struct {
+	ForceNetworkInterface string
+	SourceAddress         string
+	SourceInterface       string
+	FwMark                uint32
+	TOS                   int
+	Netns                 string
+	DNSServers            []string
+	Hosts                 map[string]string
+	TLS                   TLSOptions
+	Proxy                 *url.URL
+	Timeout               time.Duration
+	RetryCount            int
+	RetryWait             time.Duration
+	Logger                *log.Logger
+	Transport             http.RoundTripper
+}
+
+func (config httpClientConfig) needDialer() bool {
+	return config.ForceNetworkInterface != "" || config.SourceAddress != "" || config.SourceInterface != "" ||
+		config.FwMark != 0 || config.TOS != 0 || config.Netns != "" || len(config.DNSServers) > 0 || len(config.Hosts) > 0
+}
+
+func getHttpClient(config httpClientConfig) (*http.Client, error) {
+	client := retryableHttp.NewClient()
+	client.HTTPClient.Timeout = config.Timeout
+	client.RetryMax = config.RetryCount
+	client.RetryWaitMin = config.RetryWait
+	client.RetryWaitMax = config.RetryWait
+	client.Logger = config.Logger
+	// return the last response when the retries are used up, so that a 5xx status is reported as StatusError
+	client.ErrorHandler = retryableHttp.PassthroughErrorHandler
+	if config.Transport != nil {
+		client.HTTPClient.Transport = config.Transport
+	}
+
+	if config.needDialer() || !config.TLS.isZero() || config.Proxy != nil {
+		transport := cleanhttp.DefaultPooledTransport()
+		if config.Proxy != nil {
+			// the proxy is reached via the dialer below, so that it follows the same binding
+			transport.Proxy = http.ProxyURL(config.Proxy)
+		}
+		if config.needDialer() {
+			dialContext, err := getDialContext(config)
+			if err != nil {
+				return nil, err
+			}
+			transport.DialContext = dialContext
+		}
+		if !config.TLS.isZero() {
+			tlsConfig, err := getTLSConfig(config.TLS)
+			if err != nil {
+				return nil, err
+			}
+			transport.TLSClientConfig = tlsConfig
+		}
+		client.HTTPClient.Transport = transport
+	}
+	return client.StandardClient(), nil
+}
+
+type dialContextFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+func getDialContext(config httpClientConfig) (dialContextFunc, error) {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		DualStack: true,
+	}
+	err := controlDialer(dialer, config)
+	if err != nil {
+		return nil, err
+	}
+	var sourceIP net.IP
+	if config.SourceAddress != "" {
+		sourceIP = net.ParseIP(config.SourceAddress)
+		if sourceIP == nil {
+			return nil, errors.New("invalid source address " + config.SourceAddress)
+		}
+	}
+	if config.Netns != "" {
+		// the fast fallback dials in another goroutine, which might run outside the network namespace
+		dialer.FallbackDelay = -1
+	}
+
+	var dialContext dialContextFunc = func(ctx context.Context, network, address string) (net.Conn, error) {
+		ip := sourceIP
+		if config.SourceInterface != "" {
+			// the address of the interface is resolved on every dial, so that a renewed DHCP lease is picked up
+			ipStr, err := utils.GetIPv4FromInterface(config.SourceInterface)
+			if err != nil {
+				return nil, err
+			}
+			ip = net.ParseIP(ipStr)
+		}
+		d := *dialer
+		if ip != nil {
+			d.LocalAddr = localAddr(network, ip)
+		}
+		return d.DialContext(ctx, network, address)
+	}
+	if config.Netns != "" {
+		dialContext, err = dialInNetns(config.Netns, dialContext)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(config.DNSServers) > 0 || len(config.Hosts) > 0 {
+		dialContext = resolveWith(config, dialContext)
+	}
+	return dialContext, nil
+}
+
+func localAddr(network string, ip net.IP) net.Addr {
+	switch network {
+	case "udp", "udp4", "udp6":
+		return &net.UDPAddr{IP: ip}
+	default:
+		return &net.TCPAddr{IP: ip}
+	}
+}
+
+// resolveWith looks up the host names with the static hosts and the DNS servers of the config, instead of the system
+// resolver, which is often unusable when the portal session drops. The DNS queries are sent via dialContext, so that
+// they follow the same interface binding as the portal traffic.
+func resolveWith(config httpClientConfig, dialContext dialContextFunc) dialContextFunc {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		if net.ParseIP(host) != nil {
+			return dialContext(ctx, network, address)
+		}
+
+		ips, err := lookupHost(ctx, config, dialContext, host)
+		if err != nil {
+			return nil, err
+		}
+
+		var lastErr error
+		for _, ip := range ips {
+			conn, err := dialContext(ctx, network, net.JoinHostPort(ip, port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		return nil, lastErr
+	}
+}
+
+func lookupHost(ctx context.Context, config httpClientConfig, dialContext dialContextFunc, host string) ([]string, error) {
+	if ip, ok := config.Hosts[host]; ok {
+		config.Logger.Println("Resolved", host, "to", ip, "via the static hosts")
+		return []string{ip}, nil
+	}
+	if len(config.DNSServers) == 0 {
+		return net.DefaultResolver.LookupHost(ctx, host)
+	}
+
+	var lastErr error
+	for _, server := range config.DNSServers {
+		server := server
+		resolver := &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return dialContext(ctx, network, server)
+			},
+		}
+		ips, err := resolver.LookupHost(ctx, host)
+		if err == nil {
+			config.Logger.Println("Resolved", host, "to", ips, "via", server)
+			return ips, nil
+		}
+		config.Logger.Println("Failed to resolve", host, "via", server+":", err)
+		lastErr = err
+	}
+	return nil, lastErr
+}
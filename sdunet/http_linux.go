@@ -11,44 +11,106 @@ THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR I
 package sdunet
 
 import (
-	"github.com/hashicorp/go-cleanhttp"
-	retryableHttp "github.com/hashicorp/go-retryablehttp"
+	"context"
+	"fmt"
 	"golang.org/x/sys/unix"
-	"log"
 	"net"
-	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
 	"syscall"
-	"time"
 )
 
-func getHttpClient(forceNetworkInterface string, timeout time.Duration, retryCount int, retryWait time.Duration, logger *log.Logger) (*http.Client, error) {
-	client := retryableHttp.NewClient()
-	client.HTTPClient.Timeout = timeout
-	client.RetryMax = retryCount
-	client.RetryWaitMin = retryWait
-	client.RetryWaitMax = retryWait
-	client.Logger = logger
-
-	if forceNetworkInterface != "" {
-		// https://iximiuz.com/en/posts/go-net-http-setsockopt-example/
-		// https://linux.die.net/man/7/socket
-		transport := cleanhttp.DefaultPooledTransport()
-		dialer := &net.Dialer{
-			Timeout:   30 * time.Second,
-			KeepAlive: 30 * time.Second,
-			DualStack: true,
-			Control: func(network, address string, conn syscall.RawConn) error {
-				var operr error
-				if err := conn.Control(func(fd uintptr) {
-					operr = unix.BindToDevice(int(fd), forceNetworkInterface)
-				}); err != nil {
-					return err
-				}
-				return operr
-			},
-		}
-		transport.DialContext = dialer.DialContext
-		client.HTTPClient.Transport = transport
+// controlDialer sets the socket options of the dialer. SO_BINDTODEVICE and SO_MARK require CAP_NET_RAW and CAP_NET_ADMIN.
+func controlDialer(dialer *net.Dialer, config httpClientConfig) error {
+	if config.ForceNetworkInterface == "" && config.FwMark == 0 && config.TOS == 0 {
+		return nil
 	}
-	return client.StandardClient(), nil
+	// https://iximiuz.com/en/posts/go-net-http-setsockopt-example/
+	// https://linux.die.net/man/7/socket
+	dialer.Control = func(network, address string, conn syscall.RawConn) error {
+		var operr error
+		if err := conn.Control(func(fd uintptr) {
+			operr = setSocketOptions(int(fd), network, config)
+		}); err != nil {
+			return err
+		}
+		return operr
+	}
+	return nil
+}
+
+func setSocketOptions(fd int, network string, config httpClientConfig) error {
+	if config.ForceNetworkInterface != "" {
+		err := unix.BindToDevice(fd, config.ForceNetworkInterface)
+		if err != nil {
+			return err
+		}
+	}
+	if config.FwMark != 0 {
+		err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_MARK, int(config.FwMark))
+		if err != nil {
+			return err
+		}
+	}
+	if config.TOS != 0 {
+		var err error
+		if network == "tcp6" || network == "udp6" {
+			err = unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, unix.IPV6_TCLASS, config.TOS)
+		} else {
+			err = unix.SetsockoptInt(fd, unix.IPPROTO_IP, unix.IP_TOS, config.TOS)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dialInNetns creates the sockets inside the network namespace, e.g. /var/run/netns/campus, while the rest of the
+// program stays in its own namespace. A bare name is looked up in /var/run/netns. It requires CAP_SYS_ADMIN.
+// The DNS lookup is not affected.
+func dialInNetns(netns string, dialContext dialContextFunc) (dialContextFunc, error) {
+	if !filepath.IsAbs(netns) {
+		netns = filepath.Join("/var/run/netns", netns)
+	}
+	if _, err := os.Stat(netns); err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		// setns only affects the current OS thread
+		runtime.LockOSThread()
+
+		origin, err := os.Open(fmt.Sprintf("/proc/self/task/%d/ns/net", unix.Gettid()))
+		if err != nil {
+			runtime.UnlockOSThread()
+			return nil, err
+		}
+		defer origin.Close()
+
+		target, err := os.Open(netns)
+		if err != nil {
+			runtime.UnlockOSThread()
+			return nil, err
+		}
+		defer target.Close()
+
+		err = unix.Setns(int(target.Fd()), unix.CLONE_NEWNET)
+		if err != nil {
+			runtime.UnlockOSThread()
+			return nil, err
+		}
+
+		conn, err := dialContext(ctx, network, address)
+
+		// if the namespace can't be restored, the thread is left locked, so that it is terminated with the goroutine
+		if restoreErr := unix.Setns(int(origin.Fd()), unix.CLONE_NEWNET); restoreErr == nil {
+			runtime.UnlockOSThread()
+		} else if err == nil {
+			conn.Close()
+			return nil, restoreErr
+		}
+		return conn, err
+	}, nil
 }
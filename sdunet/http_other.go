@@ -12,22 +12,19 @@ package sdunet
 
 import (
 	"errors"
-	retryableHttp "github.com/hashicorp/go-retryablehttp"
-	"log"
-	"net/http"
-	"time"
+	"net"
 )
 
-func getHttpClient(forceNetworkInterface string, timeout time.Duration, retryCount int, retryWait time.Duration, logger *log.Logger) (*http.Client, error) {
-	client := retryableHttp.NewClient()
-	client.HTTPClient.Timeout = timeout
-	client.RetryMax = retryCount
-	client.RetryWaitMin = retryWait
-	client.RetryWaitMax = retryWait
-	client.Logger = logger
-
-	if forceNetworkInterface != "" {
-		return nil, errors.New("the strict mode is only available in Linux")
+func controlDialer(dialer *net.Dialer, config httpClientConfig) error {
+	if config.ForceNetworkInterface != "" {
+		return errors.New("binding to a network interface device is only available in Linux. Bind to the source address instead")
+	}
+	if config.FwMark != 0 || config.TOS != 0 {
+		return errors.New("the firewall mark and the TOS are only available in Linux")
 	}
-	return client.StandardClient(), nil
+	return nil
+}
+
+func dialInNetns(netns string, dialContext dialContextFunc) (dialContextFunc, error) {
+	return nil, errors.New("the network namespace is only available in Linux")
 }
@@ -0,0 +1,124 @@
+/*
+Copyright © 2018-2022 Sad Pencil
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the “Software”), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package sdunet_test
+
+import (
+	"context"
+	"encoding/binary"
+	"github.com/SadPencil/sdunetd/sdunet"
+	"net"
+	"strings"
+	"testing"
+)
+
+// startDNSServer answers the A queries of the records over UDP, and NXDOMAIN for the other names. Close the returned
+// connection after the test.
+func startDNSServer(t *testing.T, records map[string]string) net.PacketConn {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if response := answerDNS(buf[:n], records); response != nil {
+				_, _ = conn.WriteTo(response, addr)
+			}
+		}
+	}()
+	return conn
+}
+
+func answerDNS(query []byte, records map[string]string) []byte {
+	if len(query) < 12 {
+		return nil
+	}
+	// the question: the labels of the name, then the type and the class
+	var labels []string
+	end := 12
+	for end < len(query) && query[end] != 0 {
+		length := int(query[end])
+		if end+1+length > len(query) {
+			return nil
+		}
+		labels = append(labels, string(query[end+1:end+1+length]))
+		end += 1 + length
+	}
+	end += 5
+	if end > len(query) {
+		return nil
+	}
+	qtype := binary.BigEndian.Uint16(query[end-4:])
+	ip, known := records[strings.ToLower(strings.Join(labels, "."))]
+
+	response := append([]byte{}, query[:2]...)
+	if known {
+		response = append(response, 0x81, 0x80)
+	} else {
+		response = append(response, 0x81, 0x83)
+	}
+	answers := uint16(0)
+	if known && qtype == 1 {
+		answers = 1
+	}
+	response = append(response, 0, 1, byte(answers>>8), byte(answers), 0, 0, 0, 0)
+	response = append(response, query[12:end]...)
+	if answers > 0 {
+		// a pointer to the name of the question, type A, class IN, a TTL of 60 seconds and the address
+		response = append(response, 0xc0, 12, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4)
+		response = append(response, net.ParseIP(ip).To4()...)
+	}
+	return response
+}
+
+func TestLookupWithHostsAndDNSServers(t *testing.T) {
+	portal, addr := startPortal(t, "10.0.0.2")
+	defer portal.Close()
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dns := startDNSServer(t, map[string]string{"portal.test": "127.0.0.1"})
+	defer dns.Close()
+	// nothing listens here, so the query is refused at once
+	unreachable := startDNSServer(t, nil)
+	unreachableAddr := unreachable.LocalAddr().String()
+	unreachable.Close()
+
+	tests := []struct {
+		name   string
+		server string
+		opts   []sdunet.Option
+		ok     bool
+	}{
+		{"static hosts", "hosts.test", []sdunet.Option{sdunet.WithHosts(map[string]string{"hosts.test": "127.0.0.1"})}, true},
+		{"hosts before the DNS servers", "hosts.test", []sdunet.Option{
+			sdunet.WithHosts(map[string]string{"hosts.test": "127.0.0.1"}),
+			sdunet.WithDNSServers(unreachableAddr),
+		}, true},
+		{"DNS server", "portal.test", []sdunet.Option{sdunet.WithDNSServers(dns.LocalAddr().String())}, true},
+		{"the next DNS server after a failure", "portal.test", []sdunet.Option{
+			sdunet.WithDNSServers(unreachableAddr, dns.LocalAddr().String()),
+		}, true},
+		{"unknown to the DNS server", "unknown.test", []sdunet.Option{sdunet.WithDNSServers(dns.LocalAddr().String())}, false},
+		{"unreachable DNS server", "portal.test", []sdunet.Option{sdunet.WithDNSServers(unreachableAddr)}, false},
+	}
+	for _, test := range tests {
+		client := newTestClient(t, net.JoinHostPort(test.server, port), test.opts...)
+		_, err := client.GetUserInfo(context.Background())
+		if test.ok && err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if !test.ok && err == nil {
+			t.Errorf("%s: the portal is reached", test.name)
+		}
+	}
+}
@@ -8,20 +8,16 @@ THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR I
 package sdunet
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
-	"errors"
-	"io/ioutil"
 	"log"
 	"net/http"
-	"net/url"
 	"time"
 )
 
+// MangerBase holds the connection settings of a Manager.
+//
+// Deprecated: use NewClient instead.
 type MangerBase struct {
-	client *http.Client
-
 	Scheme                string
 	Server                string
 	ForceNetworkInterface string
@@ -29,8 +25,15 @@ type MangerBase struct {
 	MaxRetryCount         int
 	RetryWait             time.Duration
 	Logger                *log.Logger
+
+	// shared is the Client created by GetManager and reused by the methods. A Manager built as a literal creates a
+	// Client per call instead.
+	shared *Client
 }
 
+// Manager is the former API of this package. Its methods are thin wrappers of Client.
+//
+// Deprecated: use NewClient instead.
 type Manager struct {
 	MangerBase
 	Username string
@@ -42,6 +45,9 @@ type UserInfo struct {
 	LoggedIn bool
 }
 
+// GetManager creates a Manager and discovers the client IP address from the portal.
+//
+// Deprecated: use NewClient instead.
 func GetManager(ctx context.Context, scheme string, server string, username string, forceNetworkInterface string) (Manager, error) {
 	base := MangerBase{
 		Scheme:                scheme,
@@ -52,10 +58,16 @@ func GetManager(ctx context.Context, scheme string, server string, username stri
 		RetryWait:             1 * time.Second,
 		Logger:                log.Default(),
 	}
-	info, err := base.GetUserInfo(ctx)
+	client, err := NewClient(append(base.options(), WithUsername(username))...)
 	if err != nil {
 		return Manager{}, err
 	}
+	info, err := client.GetUserInfo(ctx)
+	if err != nil {
+		return Manager{}, err
+	}
+	client.SetClientIP(info.ClientIP)
+	base.shared = client
 	return Manager{
 		MangerBase: base,
 		Username:   username,
@@ -63,159 +75,64 @@ func GetManager(ctx context.Context, scheme string, server string, username stri
 	}, nil
 }
 
-func (m MangerBase) GetHttpClient() (*http.Client, error) {
-	if m.client == nil {
-		client, err := getHttpClient(m.ForceNetworkInterface, m.Timeout, m.MaxRetryCount, m.RetryWait, m.Logger)
-		if err != nil {
-			return nil, err
-		}
-		m.client = client
+func (m MangerBase) options() []Option {
+	return []Option{
+		WithScheme(m.Scheme),
+		WithServer(m.Server),
+		WithNetworkInterface(m.ForceNetworkInterface),
+		WithTimeout(m.Timeout),
+		WithRetry(m.MaxRetryCount, m.RetryWait),
+		WithLogger(m.Logger),
 	}
-	return m.client, nil
 }
 
-func (m Manager) getRawChallenge(ctx context.Context) (map[string]interface{}, error) {
-	return m.httpJsonQuery(ctx,
-		"/cgi-bin/get_challenge",
-		map[string][]string{
-			"username": {m.Username},
-			"ip":       {m.ClientIP},
-		},
-		"jQuery",
-	)
-}
-
-func (m MangerBase) getRawUserInfo(ctx context.Context) (map[string]interface{}, error) {
-	return m.httpJsonQuery(ctx,
-		"/cgi-bin/rad_user_info",
-		map[string][]string{},
-		"jQuery",
-	)
-}
-func (m MangerBase) GetUserInfo(ctx context.Context) (UserInfo, error) {
-	output, err := m.getRawUserInfo(ctx)
-	if err != nil {
-		return UserInfo{}, err
+func (m MangerBase) client() (*Client, error) {
+	if m.shared != nil {
+		return m.shared, nil
 	}
-	return UserInfo{
-		ClientIP: output["online_ip"].(string),
-		LoggedIn: output["error"].(string) == "ok",
-	}, nil
+	return NewClient(m.options()...)
 }
 
-func (m MangerBase) httpJsonQuery(ctx context.Context, relativeUrl string, getParams url.Values, jsonCallback string) (map[string]interface{}, error) {
-	if relativeUrl[0] != '/' {
-		return nil, errors.New("invalid relative url")
-	}
-
-	client, err := m.GetHttpClient()
-	if err != nil {
-		return nil, err
-	}
-
-	req, err := http.NewRequestWithContext(ctx, "GET", m.Scheme+"://"+m.Server+relativeUrl, nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Add("Accept", "application/json")
-	if jsonCallback != "" {
-		getParams.Add("callback", jsonCallback)
-	}
-	req.URL.RawQuery = getParams.Encode()
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return nil, errors.New(resp.Status)
-	}
-
-	respBody, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	if bytes.Equal(respBody[0:len(jsonCallback)+1], []byte(jsonCallback+"(")) {
-		respBody = respBody[len(jsonCallback)+1:]
-		respBody = respBody[:len(respBody)-1]
+// client returns the shared Client, or a new one for a Manager built as a literal.
+func (m Manager) client() (*Client, error) {
+	if m.shared != nil {
+		// the client IP address may be changed after GetManager
+		if m.ClientIP != "" {
+			m.shared.SetClientIP(m.ClientIP)
+		}
+		return m.shared, nil
 	}
+	return NewClient(append(m.options(), WithUsername(m.Username), WithClientIP(m.ClientIP))...)
+}
 
-	var output map[string]interface{}
-	err = json.Unmarshal(respBody, &output)
+func (m MangerBase) GetHttpClient() (*http.Client, error) {
+	client, err := m.client()
 	if err != nil {
 		return nil, err
 	}
-
-	return output, nil
+	return client.GetHttpClient()
 }
 
-func (m Manager) getChallengeID(ctx context.Context) (string, error) {
-	output, err := m.getRawChallenge(ctx)
+func (m MangerBase) GetUserInfo(ctx context.Context) (UserInfo, error) {
+	client, err := m.client()
 	if err != nil {
-		return "", err
+		return UserInfo{}, err
 	}
-	return output["challenge"].(string), nil
+	return client.GetUserInfo(ctx)
 }
 
 func (m Manager) Login(ctx context.Context, password string) error {
-	challenge, err := m.getChallengeID(ctx)
+	client, err := m.client()
 	if err != nil {
 		return err
 	}
-
-	var dataInfoStr, dataPasswordMd5Str, dataChecksumStr string
-	err = sdunetChallenge(m.Username, password, m.ClientIP, challenge, &dataInfoStr, &dataPasswordMd5Str, &dataChecksumStr)
-	if err != nil {
-		return err
-	}
-
-	output, err := m.httpJsonQuery(ctx,
-		"/cgi-bin/srun_portal",
-		map[string][]string{
-			"action":   {"login"},
-			"username": {m.Username},
-			"password": {dataPasswordMd5Str},
-			"ac_id":    {"1"},
-			"ip":       {m.ClientIP},
-			"info":     {dataInfoStr},
-			"chksum":   {dataChecksumStr},
-			"n":        {"200"},
-			"type":     {"1"},
-		},
-		"jQuery",
-	)
-	if err != nil {
-		return err
-	}
-
-	errorStr := output["error"].(string)
-	if errorStr == "ok" {
-		return nil
-	} else {
-		return errors.New(errorStr)
-	}
+	return client.Login(ctx, password)
 }
 
 func (m Manager) Logout(ctx context.Context) error {
-	output, err := m.httpJsonQuery(ctx,
-		"/cgi-bin/srun_portal",
-		map[string][]string{
-			"ac_id":    {"1"},
-			"action":   {"logout"},
-			"username": {m.Username},
-		},
-		"jQuery",
-	)
+	client, err := m.client()
 	if err != nil {
 		return err
 	}
-	errorStr := output["error"].(string)
-	if errorStr == "ok" {
-		return nil
-	} else {
-		return errors.New(errorStr)
-	}
+	return client.Logout(ctx)
 }
@@ -0,0 +1,72 @@
+/*
+Copyright © 2018-2022 Sad Pencil
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the “Software”), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package sdunet_test
+
+import (
+	"context"
+	"github.com/SadPencil/sdunetd/sdunet"
+	"io/ioutil"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestManagerReusesTheClient(t *testing.T) {
+	portal, addr := startPortal(t, "10.0.0.2")
+	defer portal.Close()
+	ctx := context.Background()
+
+	manager, err := sdunet.GetManager(ctx, "http", addr, "201800000000", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manager.ClientIP != "10.0.0.2" {
+		t.Errorf("the client IP address is %q", manager.ClientIP)
+	}
+	first, err := manager.GetHttpClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Login(ctx, "password"); err != nil {
+		t.Fatal(err)
+	}
+	second, err := manager.GetHttpClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Error("a new client is created per call")
+	}
+	if !portal.Online() {
+		t.Error("the manager isn't logged in")
+	}
+	if err := manager.Logout(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if portal.Online() {
+		t.Error("the manager isn't logged out")
+	}
+
+	// a Manager built as a literal still works
+	literal := sdunet.Manager{
+		MangerBase: sdunet.MangerBase{
+			Scheme:  "http",
+			Server:  addr,
+			Timeout: time.Second,
+			Logger:  log.New(ioutil.Discard, "", 0),
+		},
+		Username: "201800000000",
+		ClientIP: "10.0.0.2",
+	}
+	if err := literal.Login(ctx, "password"); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := literal.GetUserInfo(ctx); err != nil || !info.LoggedIn {
+		t.Errorf("the literal manager isn't logged in: %v", err)
+	}
+}
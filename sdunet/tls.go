@@ -0,0 +1,108 @@
+/*
+Copyright © 2018-2022 Sad Pencil
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the “Software”), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package sdunet
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"strings"
+)
+
+// TLSOptions hardens the HTTPS connections to the portal.
+type TLSOptions struct {
+	// CAFile is a PEM bundle of the trusted CAs, replacing the system ones. Empty means the system CAs.
+	CAFile string
+	// PinSHA256 lists the SHA-256 fingerprints of the certificates, in hex with optional colons. When the chain is
+	// verified, the connection is refused unless a certificate of the verified chain matches any of them, so a CA can be
+	// pinned. With InsecureSkipVerify, only the leaf certificate is matched, since the rest of the chain is unverified.
+	PinSHA256 []string
+	// ServerName overrides the SNI and the name to verify. Empty means the host of the server.
+	ServerName string
+	// MinVersion is the minimum TLS version, e.g. tls.VersionTLS12. Zero means the default of Go.
+	MinVersion uint16
+	// InsecureSkipVerify skips the verification of the certificate chain and the host name. With PinSHA256, pin the leaf certificate of the portal.
+	InsecureSkipVerify bool
+}
+
+func (o TLSOptions) isZero() bool {
+	return o.CAFile == "" && len(o.PinSHA256) == 0 && o.ServerName == "" && o.MinVersion == 0 && !o.InsecureSkipVerify
+}
+
+// ParsePinSHA256 parses a SHA-256 fingerprint like AB:CD:... or abcd...
+func ParsePinSHA256(pin string) ([]byte, error) {
+	fingerprint, err := hex.DecodeString(strings.ReplaceAll(strings.TrimSpace(pin), ":", ""))
+	if err != nil || len(fingerprint) != sha256.Size {
+		return nil, errors.New("invalid SHA-256 fingerprint " + pin)
+	}
+	return fingerprint, nil
+}
+
+func getTLSConfig(options TLSOptions) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         options.ServerName,
+		MinVersion:         options.MinVersion,
+		InsecureSkipVerify: options.InsecureSkipVerify,
+	}
+
+	if options.CAFile != "" {
+		pem, err := ioutil.ReadFile(options.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificate is found in " + options.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if len(options.PinSHA256) > 0 {
+		var pins [][]byte
+		for _, pin := range options.PinSHA256 {
+			fingerprint, err := ParsePinSHA256(pin)
+			if err != nil {
+				return nil, err
+			}
+			pins = append(pins, fingerprint)
+		}
+		// it is called after the chain is verified, or right away if the verification is skipped
+		config.VerifyPeerCertificate = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+			if options.InsecureSkipVerify {
+				// anything after the leaf may be appended by whoever serves it, e.g. the public certificate of a pinned CA
+				if len(rawCerts) > 0 && matchPin(pins, rawCerts[0]) {
+					return nil
+				}
+			} else {
+				for _, chain := range verifiedChains {
+					for _, cert := range chain {
+						if matchPin(pins, cert.Raw) {
+							return nil
+						}
+					}
+				}
+			}
+			return errors.New("the certificate of the portal doesn't match any pinned fingerprint")
+		}
+	}
+	return config, nil
+}
+
+func matchPin(pins [][]byte, rawCert []byte) bool {
+	fingerprint := sha256.Sum256(rawCert)
+	for _, pin := range pins {
+		if bytes.Equal(fingerprint[:], pin) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+/*
+Copyright © 2018-2022 Sad Pencil
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the “Software”), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package sdunet
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"testing"
+)
+
+func pinOf(raw []byte) string {
+	fingerprint := sha256.Sum256(raw)
+	return hex.EncodeToString(fingerprint[:])
+}
+
+func TestPinSHA256(t *testing.T) {
+	leaf := []byte("leaf certificate")
+	ca := []byte("ca certificate")
+	chain := [][]*x509.Certificate{{{Raw: leaf}, {Raw: ca}}}
+
+	tests := []struct {
+		name           string
+		insecure       bool
+		pin            []byte
+		rawCerts       [][]byte
+		verifiedChains [][]*x509.Certificate
+		ok             bool
+	}{
+		{"leaf without verification", true, leaf, [][]byte{leaf, ca}, nil, true},
+		{"appended CA without verification", true, ca, [][]byte{leaf, ca}, nil, false},
+		{"CA of the verified chain", false, ca, [][]byte{leaf}, chain, true},
+		{"leaf of the verified chain", false, leaf, [][]byte{leaf}, chain, true},
+		{"CA sent but not verified", false, ca, [][]byte{leaf, ca}, [][]*x509.Certificate{{{Raw: leaf}}}, false},
+	}
+	for _, test := range tests {
+		config, err := getTLSConfig(TLSOptions{PinSHA256: []string{pinOf(test.pin)}, InsecureSkipVerify: test.insecure})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = config.VerifyPeerCertificate(test.rawCerts, test.verifiedChains)
+		if (err == nil) != test.ok {
+			t.Errorf("%s: got %v", test.name, err)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+/*
+Copyright © 2018-2022 Sad Pencil
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the “Software”), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package setting
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const ENCRYPTED_PASSWORD_PREFIX = "aesgcm:"
+
+// machineIDFiles are read in order when no key file is given.
+var machineIDFiles = []string{"/etc/machine-id", "/var/lib/dbus/machine-id"}
+
+// LoadKey derives the AES-256 key from the key file, or from the machine-id if keyFile is empty.
+func LoadKey(keyFile string) ([]byte, error) {
+	var material []byte
+	if keyFile != "" {
+		content, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		material = content
+	} else {
+		for _, file := range machineIDFiles {
+			content, err := ioutil.ReadFile(file)
+			if err == nil && strings.TrimSpace(string(content)) != "" {
+				material = []byte(strings.TrimSpace(string(content)))
+				break
+			}
+		}
+		if material == nil {
+			return nil, errors.New(text("crypto.machine_id"))
+		}
+	}
+	if len(material) == 0 {
+		return nil, errors.New(text("crypto.key_file_empty", keyFile))
+	}
+
+	key := sha256.Sum256(append([]byte("sdunetd password key\x00"), material...))
+	return key[:], nil
+}
+
+// GenerateKeyFile writes 32 random bytes to a new key file, readable by the owner only.
+func GenerateKeyFile(keyFile string) error {
+	material := make([]byte, 32)
+	_, err := rand.Read(material)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(keyFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(material)
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+// EncryptPassword seals the password with AES-GCM. The result is "aesgcm:" followed by the base64 of the nonce and the ciphertext.
+func EncryptPassword(key []byte, password string) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(password), nil)
+	return ENCRYPTED_PASSWORD_PREFIX + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptPassword opens a password sealed by EncryptPassword.
+func DecryptPassword(key []byte, encrypted string) (string, error) {
+	if !strings.HasPrefix(encrypted, ENCRYPTED_PASSWORD_PREFIX) {
+		return "", errors.New(text("crypto.prefix", ENCRYPTED_PASSWORD_PREFIX))
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(encrypted, ENCRYPTED_PASSWORD_PREFIX))
+	if err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New(text("crypto.truncated"))
+	}
+	password, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New(text("crypto.decrypt"))
+	}
+	return string(password), nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -9,7 +9,24 @@ package setting
 
 const DEFAULT_AUTH_SERVER string = "101.76.193.1"
 const DEFAULT_AUTH_SCHEME string = "http"
+const DEFAULT_AC_ID string = "1"
 const DEFAULT_CONFIG_FILENAME string = "config.json"
 
+// CONFIG_VERSION is the layout version of the config file written by this release.
+const CONFIG_VERSION = 3
+
 const ONLINE_DETECTION_METHOD_AUTH = "auth"
 const ONLINE_DETECTION_METHOD_MS = "ms"
+
+const IP_SOURCE_PORTAL = "portal"
+const IP_SOURCE_INTERFACE = "interface"
+const IP_SOURCE_FIXED = "fixed"
+const IP_SOURCE_COMMAND = "command"
+
+const BIND_MODE_DEVICE = "device"
+const BIND_MODE_ADDRESS = "address"
+
+const TLS_VERSION_1_0 = "1.0"
+const TLS_VERSION_1_1 = "1.1"
+const TLS_VERSION_1_2 = "1.2"
+const TLS_VERSION_1_3 = "1.3"
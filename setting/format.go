@@ -0,0 +1,108 @@
+/*
+Copyright © 2018-2022 Sad Pencil
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the “Software”), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package setting
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const FORMAT_JSON = "json"
+const FORMAT_YAML = "yaml"
+const FORMAT_TOML = "toml"
+
+var tomlTablePattern = regexp.MustCompile(`(?m)^\s*\[[A-Za-z0-9_.]+\]\s*$`)
+
+// FormatFromExtension returns the format of the config file by its extension, or an empty string if it is unknown.
+func FormatFromExtension(configPath string) string {
+	switch strings.ToLower(filepath.Ext(configPath)) {
+	case ".json":
+		return FORMAT_JSON
+	case ".yaml", ".yml":
+		return FORMAT_YAML
+	case ".toml":
+		return FORMAT_TOML
+	default:
+		return ""
+	}
+}
+
+// DetectFormat returns the format of the config file by its extension, or by its content if the extension is unknown.
+func DetectFormat(configPath string, content []byte) string {
+	if format := FormatFromExtension(configPath); format != "" {
+		return format
+	}
+	trimmed := bytes.TrimSpace(content)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		return FORMAT_JSON
+	}
+	if tomlTablePattern.Match(content) {
+		return FORMAT_TOML
+	}
+	return FORMAT_YAML
+}
+
+// Unmarshal parses the config file of the format into settings. The fields missing from the file are left untouched.
+func Unmarshal(format string, content []byte, settings *Settings) error {
+	return unmarshalValue(format, content, settings)
+}
+
+func unmarshalValue(format string, content []byte, v interface{}) error {
+	switch format {
+	case FORMAT_JSON:
+		return json.Unmarshal(content, v)
+	case FORMAT_YAML:
+		return yaml.Unmarshal(content, v)
+	case FORMAT_TOML:
+		return toml.Unmarshal(content, v)
+	default:
+		return errors.New(text("format.unknown", format))
+	}
+}
+
+// unmarshalRaw parses the config file of the format into nested maps, keeping the keys unknown to Settings.
+func unmarshalRaw(format string, content []byte) (map[string]interface{}, error) {
+	raw := make(map[string]interface{})
+	var err error
+	switch format {
+	case FORMAT_JSON:
+		err = json.Unmarshal(content, &raw)
+	case FORMAT_YAML:
+		err = yaml.Unmarshal(content, &raw)
+	case FORMAT_TOML:
+		err = toml.Unmarshal(content, &raw)
+	default:
+		err = errors.New(text("format.unknown", format))
+	}
+	return raw, err
+}
+
+// Marshal encodes settings into the format.
+func Marshal(format string, settings *Settings) ([]byte, error) {
+	switch format {
+	case FORMAT_JSON:
+		return json.MarshalIndent(settings, "", "  ")
+	case FORMAT_YAML:
+		return yaml.Marshal(settings)
+	case FORMAT_TOML:
+		var buf bytes.Buffer
+		err := toml.NewEncoder(&buf).Encode(settings)
+		if err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, errors.New(text("format.unknown", format))
+	}
+}
@@ -0,0 +1,83 @@
+/*
+Copyright © 2018-2022 Sad Pencil
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the “Software”), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package setting
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSaveAndLoadInEveryFormat(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	settings := NewSettings()
+	settings.Account.Username = "201700000000"
+	settings.Account.Password = "secret"
+	settings.Network.Interface = "eth0"
+	settings.Network.StrictMode = true
+	settings.Network.FwMark = 0x100
+	settings.Network.TOS = 16
+	settings.Network.DNSServers = []string{"10.0.0.1", "10.0.0.2:53"}
+	settings.Network.Hosts = map[string]string{"portal.example": "10.0.0.1"}
+	settings.Network.TLS.PinSHA256 = []string{"abc"}
+	settings.Network.TLS.InsecureSkipVerify = true
+	settings.Network.Headers = map[string]string{"X-Requested-With": "XMLHttpRequest"}
+	settings.Control.LoopIntervalSec = 30
+	settings.Devices = []Device{{Name: "printer", IP: "10.0.0.50", ReloginIntervalSec: 3600}}
+
+	for _, name := range []string{"config.json", "config.yaml", "config.yml", "config.toml"} {
+		configPath := filepath.Join(dir, name)
+		if err := SaveSettings(configPath, settings); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		loaded, err := LoadSettings(configPath)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if !reflect.DeepEqual(loaded, settings) {
+			t.Errorf("%s: got %+v, want %+v", name, loaded, settings)
+		}
+
+		// the content is recognized without the extension too
+		content, err := ioutil.ReadFile(configPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if format := DetectFormat(filepath.Join(dir, "config"), content); format != FormatFromExtension(configPath) {
+			t.Errorf("%s: the content is detected as %s", name, format)
+		}
+	}
+}
+
+func TestLoadKeepsTheDefaults(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"config.json": `{"account": {"username": "user"}}`,
+		"config.yaml": "# annotated\naccount:\n  username: user # the student ID\n",
+		"config.toml": "# annotated\n[account]\nusername = \"user\" # the student ID\n",
+	}
+	want := NewSettings()
+	want.Account.Username = "user"
+	for name, content := range files {
+		configPath := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(configPath, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		settings, err := LoadSettings(configPath)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if !reflect.DeepEqual(settings, want) {
+			t.Errorf("%s: got %+v, want %+v", name, settings, want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+/*
+Copyright © 2018-2022 Sad Pencil
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the “Software”), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package setting
+
+import (
+	"fmt"
+)
+
+// Translate returns the message of the key in the language of the user, or an empty string to keep the English one
+// in Messages. It is set by the program that shows the messages.
+var Translate func(key string) string
+
+// Messages are the English messages of the package, i.e. the migration notes, the warnings and the errors, keyed for
+// the translations. The messages are passed to fmt.Sprintf when there are arguments.
+var Messages = map[string]string{
+	"migrate.newer":         "the config file is of version %d, which is newer than %d. Please upgrade sdunetd",
+	"migrate.unsupported":   "can't migrate the config file of version %d",
+	"migrate.version":       "the version of the config file should be a number, got %v",
+	"migrate.unidentified":  `can't identify the layout of the config file, as %s is not a section of v2.4 or later. Files of v2.3 and earlier can't be migrated. Generate a new one by "sdunetd config init"`,
+	"migrate.step":          "migrated from version %d to %d",
+	"format.unknown":        "unknown config format %s",
+	"override.key_value":    "expect key=value, got %s",
+	"override.json":         "expect a JSON value",
+	"override.type":         "unsupported type %s",
+	"override.unknown":      "unknown setting %s",
+	"preset.unknown":        "unknown preset %s",
+	"preset.skipped_dir":    "Warning: skipped the preset directory: %v",
+	"preset.skipped_file":   "Warning: skipped the preset file %v",
+	"crypto.machine_id":     "can't read the machine-id. Please give a key file",
+	"crypto.key_file_empty": "the key file %s is empty",
+	"crypto.prefix":         "the encrypted password should start with %s",
+	"crypto.truncated":      "the encrypted password is truncated",
+	"crypto.decrypt":        "failed to decrypt the password. Is the key file or the machine-id changed?",
+	"permission.insecure":   "the config file holds a password but can be read by the group or others",
+}
+
+// text returns the message of the key, translated by Translate if possible.
+func text(key string, args ...interface{}) string {
+	format := Messages[key]
+	if Translate != nil {
+		if translated := Translate(key); translated != "" {
+			format = translated
+		}
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(format, args...)
+	}
+	return format
+}
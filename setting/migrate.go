@@ -0,0 +1,88 @@
+/*
+Copyright © 2018-2022 Sad Pencil
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the “Software”), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package setting
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// The layouts of the config file. Files without the version field are of v2.4, the first release whose layout is
+// known here. The versions below it stand for the layouts of v2.2 and v2.3, which are not migrated, as no config file
+// of them is at hand.
+const (
+	// CONFIG_VERSION_V2_4 is the layout of v2.4.0: account, network and control, without the version field.
+	CONFIG_VERSION_V2_4 = 3
+)
+
+// migrations upgrade the raw config file from the version to the next one.
+var migrations = map[int]func(raw map[string]interface{}) []string{}
+
+// migrate upgrades the raw config file to CONFIG_VERSION in place, and describes what is changed.
+// No notes mean the file is already in the current layout.
+func migrate(raw map[string]interface{}) ([]string, error) {
+	version, err := detectVersion(raw)
+	if err != nil {
+		return nil, err
+	}
+	if version > CONFIG_VERSION {
+		return nil, errors.New(text("migrate.newer", version, CONFIG_VERSION))
+	}
+
+	var notes []string
+	for ; version < CONFIG_VERSION; version++ {
+		upgrade, ok := migrations[version]
+		if !ok {
+			return nil, errors.New(text("migrate.unsupported", version))
+		}
+		notes = append(notes, text("migrate.step", version, version+1))
+		notes = append(notes, upgrade(raw)...)
+		raw["version"] = version + 1
+	}
+	return notes, nil
+}
+
+// detectVersion reads the version field. A file without it is of v2.4, unless it has a section unknown to Settings,
+// which is taken as a file of an older layout and refused rather than guessed. A key close to a section is taken as a typo.
+func detectVersion(raw map[string]interface{}) (int, error) {
+	if value, ok := raw["version"]; ok {
+		switch v := value.(type) {
+		case float64:
+			return int(v), nil
+		case int:
+			return v, nil
+		case int64:
+			return int(v), nil
+		default:
+			return 0, errors.New(text("migrate.version", value))
+		}
+	}
+
+	sections := make(map[string]bool)
+	var names []string
+	t := reflect.TypeOf(Settings{})
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		sections[name] = true
+		names = append(names, name)
+	}
+	var unknown []string
+	for key := range raw {
+		// a misspelled section is left to UnknownKeys
+		if !sections[strings.ToLower(key)] && key != "$schema" && closestKey(key, names) == "" {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return 0, errors.New(text("migrate.unidentified", strings.Join(unknown, ", ")))
+	}
+	return CONFIG_VERSION_V2_4, nil
+}
@@ -0,0 +1,166 @@
+/*
+Copyright © 2018-2022 Sad Pencil
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the “Software”), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package setting
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDetectVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     map[string]interface{}
+		version int
+	}{
+		{"explicit", map[string]interface{}{"version": float64(2), "log": map[string]interface{}{}}, 2},
+		{"explicit int", map[string]interface{}{"version": 3}, CONFIG_VERSION_V2_4},
+		{"v2.4", map[string]interface{}{
+			"account": map[string]interface{}{"username": "user"},
+			"network": map[string]interface{}{"strict": true},
+			"control": map[string]interface{}{"max_retry_count": float64(3)},
+		}, CONFIG_VERSION_V2_4},
+		{"later sections without the version", map[string]interface{}{
+			"$schema": "./config.schema.json",
+			"preset":  "sdu-qingdao-wired",
+			"devices": []interface{}{},
+		}, CONFIG_VERSION_V2_4},
+		{"a misspelled section", map[string]interface{}{"acount": map[string]interface{}{}}, CONFIG_VERSION_V2_4},
+		{"empty", map[string]interface{}{}, CONFIG_VERSION_V2_4},
+	}
+	for _, test := range tests {
+		version, err := detectVersion(test.raw)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if version != test.version {
+			t.Errorf("%s: got version %d, want %d", test.name, version, test.version)
+		}
+	}
+
+	failures := []struct {
+		name string
+		raw  map[string]interface{}
+	}{
+		{"a version that isn't a number", map[string]interface{}{"version": "3"}},
+		// an older layout is refused instead of guessed
+		{"an unknown section", map[string]interface{}{"account": map[string]interface{}{}, "log": map[string]interface{}{}}},
+	}
+	for _, test := range failures {
+		if _, err := detectVersion(test.raw); err == nil {
+			t.Errorf("%s is accepted", test.name)
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	migrations[CONFIG_VERSION_V2_4-1] = func(raw map[string]interface{}) []string {
+		section(raw, "account")["username"] = "migrated"
+		return []string{"renamed the user"}
+	}
+	defer delete(migrations, CONFIG_VERSION_V2_4-1)
+
+	raw := map[string]interface{}{"version": float64(CONFIG_VERSION_V2_4 - 1), "account": map[string]interface{}{}}
+	notes, err := migrate(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notes) != 2 || notes[1] != "renamed the user" {
+		t.Errorf("unexpected notes %v", notes)
+	}
+	if raw["version"] != CONFIG_VERSION || section(raw, "account")["username"] != "migrated" {
+		t.Errorf("the migration isn't applied: %v", raw)
+	}
+
+	notes, err = migrate(map[string]interface{}{"account": map[string]interface{}{}})
+	if err != nil || len(notes) != 0 {
+		t.Errorf("the current layout is migrated: %v, %v", notes, err)
+	}
+}
+
+func TestMigrateUnknownVersion(t *testing.T) {
+	for _, version := range []int{CONFIG_VERSION + 1, CONFIG_VERSION_V2_4 - 1, 0} {
+		if _, err := migrate(map[string]interface{}{"version": float64(version)}); err == nil {
+			t.Errorf("a config file of version %d is accepted", version)
+		}
+	}
+}
+
+// section returns the object of the key, or nil if it is missing or not an object.
+func section(raw map[string]interface{}, key string) map[string]interface{} {
+	object, _ := raw[key].(map[string]interface{})
+	return object
+}
+
+func TestMigrateFixtures(t *testing.T) {
+	v2_4 := NewSettings()
+	v2_4.Account.Username = "201700000000"
+	v2_4.Account.Password = "secret"
+	v2_4.Network.Interface = "eth0"
+	v2_4.Network.StrictMode = true
+	v2_4.Control.LoopIntervalSec = 30
+
+	tests := []struct {
+		file     string
+		migrated bool
+		want     *Settings
+	}{
+		{"v2.4.json", false, v2_4},
+	}
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	for _, test := range tests {
+		settings, notes, err := LoadAndMigrateSettings(filepath.Join("testdata", test.file))
+		if err != nil {
+			t.Errorf("%s: %v", test.file, err)
+			continue
+		}
+		if (len(notes) > 0) != test.migrated {
+			t.Errorf("%s: unexpected notes %v", test.file, notes)
+		}
+		if !reflect.DeepEqual(settings, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.file, settings, test.want)
+		}
+		unknownKeys, err := UnknownKeys(FORMAT_JSON, mustReadFile(t, filepath.Join("testdata", test.file)))
+		if err != nil || len(unknownKeys) != 0 {
+			t.Errorf("%s: unexpected unknown keys %v, %v", test.file, unknownKeys, err)
+		}
+
+		// the rewritten file is in the current layout, with the same settings
+		configPath := filepath.Join(dir, test.file)
+		if err := SaveSettings(configPath, settings); err != nil {
+			t.Fatal(err)
+		}
+		saved, notes, err := LoadAndMigrateSettings(configPath)
+		if err != nil {
+			t.Errorf("%s: %v", test.file, err)
+		} else if len(notes) != 0 || !reflect.DeepEqual(saved, settings) {
+			t.Errorf("%s: the rewritten file differs, notes %v", test.file, notes)
+		}
+	}
+
+	// a file of an older layout is refused
+	configPath := filepath.Join(dir, "old.json")
+	err := ioutil.WriteFile(configPath, []byte(`{"account": {"username": "user"}, "log": {}}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSettings(configPath); err == nil {
+		t.Error("a file of an older layout is loaded")
+	}
+}
+
+func mustReadFile(t *testing.T, path string) []byte {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
@@ -0,0 +1,249 @@
+/*
+Copyright © 2018-2022 Sad Pencil
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the “Software”), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package setting
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const ENV_PREFIX = "SDUNETD_"
+
+const REDACTED = "******"
+
+// FlagAliases are the short command-line flags of the frequently used settings.
+var FlagAliases = map[string]string{
+	"username":  "account.username",
+	"password":  "account.password",
+	"server":    "account.server",
+	"scheme":    "account.scheme",
+	"interface": "network.interface",
+	"interval":  "control.loop_interval_sec",
+}
+
+// Field is a setting that can be overridden, addressed by its path of JSON keys, e.g. account.username.
+type Field struct {
+	Path  string
+	Kind  reflect.Kind
+	value reflect.Value
+}
+
+// EnvName returns the environment variable of the field, e.g. SDUNETD_ACCOUNT_USERNAME.
+func (f Field) EnvName() string {
+	return ENV_PREFIX + strings.ToUpper(strings.ReplaceAll(f.Path, ".", "_"))
+}
+
+// Set parses the value into the field. Integers may be hexadecimal like 0x10, e.g. for fwmark and tos. Lists and maps
+// are either JSON, or comma-separated like a,b or k=v,k2=v2.
+func (f Field) Set(value string) error {
+	v := f.value
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := strconv.ParseUint(value, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(i)
+	case reflect.Slice, reflect.Map:
+		trimmed := strings.TrimSpace(value)
+		if strings.HasPrefix(trimmed, "[") || strings.HasPrefix(trimmed, "{") {
+			ptr := reflect.New(v.Type())
+			err := json.Unmarshal([]byte(trimmed), ptr.Interface())
+			if err != nil {
+				return err
+			}
+			v.Set(ptr.Elem())
+		} else if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String {
+			var list []string
+			for _, item := range strings.Split(trimmed, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					list = append(list, item)
+				}
+			}
+			v.Set(reflect.ValueOf(list))
+		} else if v.Kind() == reflect.Map && v.Type().Elem().Kind() == reflect.String {
+			m := make(map[string]string)
+			for _, item := range strings.Split(trimmed, ",") {
+				if item = strings.TrimSpace(item); item == "" {
+					continue
+				}
+				kv := strings.SplitN(item, "=", 2)
+				if len(kv) != 2 {
+					return errors.New(text("override.key_value", item))
+				}
+				m[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+			}
+			v.Set(reflect.ValueOf(m))
+		} else {
+			return errors.New(text("override.json"))
+		}
+	default:
+		return errors.New(text("override.type", v.Type().String()))
+	}
+	return nil
+}
+
+// Fields lists every setting that can be overridden, in the order of the struct definition.
+func Fields(settings *Settings) []Field {
+	var fields []Field
+	walkFields(reflect.ValueOf(settings).Elem(), "", &fields)
+	return fields
+}
+
+func walkFields(v reflect.Value, prefix string, fields *[]Field) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		path := prefix + name
+		if path == "version" || path == "preset" {
+			// the layout of the file, and the preset applied before the file, are not overridable
+			continue
+		}
+		if t.Field(i).Type.Kind() == reflect.Struct {
+			walkFields(v.Field(i), path+".", fields)
+			continue
+		}
+		*fields = append(*fields, Field{Path: path, Kind: t.Field(i).Type.Kind(), value: v.Field(i)})
+	}
+}
+
+// ApplyOverrides sets the fields by their paths. Unknown paths are reported as errors.
+func ApplyOverrides(settings *Settings, overrides map[string]string) error {
+	fields := make(map[string]Field)
+	for _, field := range Fields(settings) {
+		fields[field.Path] = field
+	}
+
+	// apply in a stable order, so that the error is reproducible
+	var paths []string
+	for path := range overrides {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		field, ok := fields[path]
+		if !ok {
+			return errors.New(text("override.unknown", path))
+		}
+		err := field.Set(overrides[path])
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// EnvOverrides collects the SDUNETD_* variables from the environment, e.g. os.Environ(), keyed by the setting paths.
+func EnvOverrides(environ []string) map[string]string {
+	envNames := make(map[string]string)
+	for _, field := range Fields(NewSettings()) {
+		envNames[field.EnvName()] = field.Path
+	}
+
+	overrides := make(map[string]string)
+	for _, env := range environ {
+		kv := strings.SplitN(env, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		if path, ok := envNames[kv[0]]; ok {
+			overrides[path] = kv[1]
+		}
+	}
+	return overrides
+}
+
+// Redacted returns a copy of settings with the secrets hidden, suitable for printing.
+func Redacted(settings *Settings) *Settings {
+	redacted := *settings
+	if redacted.Account.Password != "" {
+		redacted.Account.Password = REDACTED
+	}
+	if redacted.Account.EncryptedPassword != "" {
+		redacted.Account.EncryptedPassword = REDACTED
+	}
+	if redacted.Account.PasswordCommand != "" {
+		// the command may hold the password itself, e.g. echo
+		redacted.Account.PasswordCommand = REDACTED
+	}
+	redacted.Devices = nil
+	for _, device := range settings.Devices {
+		if device.Password != "" {
+			device.Password = REDACTED
+		}
+		if device.EncryptedPassword != "" {
+			device.EncryptedPassword = REDACTED
+		}
+		if device.PasswordCommand != "" {
+			device.PasswordCommand = REDACTED
+		}
+		redacted.Devices = append(redacted.Devices, device)
+	}
+	redacted.Network.Proxy = redactURL(settings.Network.Proxy)
+	redacted.Network.DetectionProxy = redactURL(settings.Network.DetectionProxy)
+	if settings.Network.Headers != nil {
+		redacted.Network.Headers = make(map[string]string)
+		for name, value := range settings.Network.Headers {
+			if isSecretHeader(name) {
+				value = REDACTED
+			}
+			redacted.Network.Headers[name] = value
+		}
+	}
+	return &redacted
+}
+
+// secretHeaderWords are found in the names of the headers that carry credentials, e.g. Authorization, Cookie or
+// X-Auth-Token.
+var secretHeaderWords = []string{"auth", "cookie", "token", "key", "secret", "session", "password"}
+
+func isSecretHeader(name string) bool {
+	name = strings.ToLower(name)
+	for _, word := range secretHeaderWords {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return rawURL
+	}
+	if _, ok := u.User.Password(); ok {
+		// asterisks would be percent-encoded in the userinfo
+		u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	}
+	return u.String()
+}
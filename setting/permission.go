@@ -0,0 +1,61 @@
+/*
+Copyright © 2018-2022 Sad Pencil
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the “Software”), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package setting
+
+import (
+	"os"
+	"runtime"
+)
+
+// ErrInsecurePermission is returned by CheckPermission when a config file holding a password can be read by others.
+var ErrInsecurePermission error = insecurePermissionError{}
+
+// insecurePermissionError is translated when printed, as ErrInsecurePermission is created before the language is known.
+type insecurePermissionError struct{}
+
+func (insecurePermissionError) Error() string {
+	return text("permission.insecure")
+}
+
+// HasSecrets tells whether the settings hold a password, encrypted or not.
+func HasSecrets(settings *Settings) bool {
+	if settings.Account.Password != "" || settings.Account.EncryptedPassword != "" {
+		return true
+	}
+	for _, device := range settings.Devices {
+		if device.Password != "" || device.EncryptedPassword != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckPermission returns ErrInsecurePermission if the config file holds a password and is group or world readable.
+// The permission bits are not checked on Windows.
+func CheckPermission(configPath string, settings *Settings) error {
+	if runtime.GOOS == "windows" || !HasSecrets(settings) {
+		return nil
+	}
+	info, err := os.Stat(configPath)
+	if err != nil {
+		return err
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return ErrInsecurePermission
+	}
+	return nil
+}
+
+// FixPermission removes the permissions of the group and others from the config file.
+func FixPermission(configPath string) error {
+	info, err := os.Stat(configPath)
+	if err != nil {
+		return err
+	}
+	return os.Chmod(configPath, info.Mode().Perm()&^0077)
+}
@@ -0,0 +1,134 @@
+/*
+Copyright © 2018-2022 Sad Pencil
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the “Software”), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package setting
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "sdunetd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestSaveSettingsIsOwnerOnly(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the permission bits are not meaningful on Windows")
+	}
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	configPath := filepath.Join(dir, "config.json")
+	err := ioutil.WriteFile(configPath, []byte("{}"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings := NewSettings()
+	settings.Account.Password = "secret"
+	err = SaveSettings(configPath, settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("got mode %v, want 0600", info.Mode().Perm())
+	}
+	err = CheckPermission(configPath, settings)
+	if err != nil {
+		t.Errorf("CheckPermission: %v", err)
+	}
+
+	loaded, err := LoadSettings(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Account.Password != "secret" {
+		t.Errorf("got password %q after loading", loaded.Account.Password)
+	}
+}
+
+func TestSaveSettingsLeavesNoTemporaryFile(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"config.json", "config.yaml", "config.toml"} {
+		err := SaveSettings(filepath.Join(dir, name), NewSettings())
+		if err != nil {
+			t.Fatal(err)
+		}
+		// saving twice replaces the existing file
+		err = SaveSettings(filepath.Join(dir, name), NewSettings())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 {
+		var names []string
+		for _, f := range files {
+			names = append(names, f.Name())
+		}
+		t.Errorf("got files %v, want only the config files", names)
+	}
+}
+
+func TestCheckPermission(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the permission bits are not meaningful on Windows")
+	}
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	configPath := filepath.Join(dir, "config.json")
+	err := ioutil.WriteFile(configPath, []byte("{}"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ioutil.WriteFile is subject to the umask
+	err = os.Chmod(configPath, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings := NewSettings()
+	err = CheckPermission(configPath, settings)
+	if err != nil {
+		t.Errorf("a file without a password: %v", err)
+	}
+
+	settings.Devices = []Device{{IP: "10.0.0.3", Password: "secret"}}
+	err = CheckPermission(configPath, settings)
+	if err != ErrInsecurePermission {
+		t.Errorf("a readable file with a password: got %v, want ErrInsecurePermission", err)
+	}
+
+	err = FixPermission(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = CheckPermission(configPath, settings)
+	if err != nil {
+		t.Errorf("after FixPermission: %v", err)
+	}
+}
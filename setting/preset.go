@@ -0,0 +1,193 @@
+/*
+Copyright © 2018-2022 Sad Pencil
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the “Software”), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package setting
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Preset holds the known settings of a campus network, referred to by its name from the config file.
+type Preset struct {
+	Name        string `json:"name" yaml:"name" toml:"name"`
+	Description string `json:"description" yaml:"description" toml:"description"`
+	// Servers are the authentication servers. The first one is the default.
+	Servers               []string `json:"servers" yaml:"servers" toml:"servers"`
+	Scheme                string   `json:"scheme" yaml:"scheme" toml:"scheme"`
+	AcID                  string   `json:"ac_id" yaml:"ac_id" toml:"ac_id"`
+	OnlineDetectionMethod string   `json:"online_detection_method" yaml:"online_detection_method" toml:"online_detection_method"`
+	Notes                 string   `json:"notes" yaml:"notes" toml:"notes"`
+}
+
+// Logger receives the warnings about the preset files that are skipped. Set it to discard them.
+var Logger = log.New(os.Stderr, "", log.LstdFlags)
+
+// PRESET_DIR_ENV names a directory of extra preset files, searched before the default ones.
+const PRESET_DIR_ENV = "SDUNETD_PRESET_DIR"
+
+// builtinPresets hold the networks listed in the README. A value that is not confirmed is left empty, so that the
+// default or the config file applies, and the notes tell what to check.
+var builtinPresets = []Preset{
+	{
+		Name:                  "sdu-qingdao-wired",
+		Description:           "Shandong University, Qingdao Campus, wired network",
+		Servers:               []string{DEFAULT_AUTH_SERVER, "[2001:250:5800:11::1]"},
+		Scheme:                DEFAULT_AUTH_SCHEME,
+		AcID:                  DEFAULT_AC_ID,
+		OnlineDetectionMethod: ONLINE_DETECTION_METHOD_AUTH,
+		Notes:                 "Either an IPv4 or an IPv6 server works.",
+	},
+	{
+		Name:                  "sdu-qingdao-wireless",
+		Description:           "Shandong University, Qingdao Campus, wireless network",
+		Servers:               []string{DEFAULT_AUTH_SERVER, "[2001:250:5800:11::1]"},
+		Scheme:                DEFAULT_AUTH_SCHEME,
+		OnlineDetectionMethod: ONLINE_DETECTION_METHOD_AUTH,
+		Notes: "The servers are the ones of the campus. The ac_id of the wireless network is not confirmed: if the login " +
+			"is refused, set account.ac_id to the ac_id in the address of the login page.",
+	},
+	{
+		Name:        "sdu-jinan-wireless",
+		Description: "Shandong University, Jinan Campuses, wireless network",
+		Scheme:      DEFAULT_AUTH_SCHEME,
+		Notes: "The authentication server is not confirmed: set account.server to the host of the login page, and " +
+			"account.ac_id to the ac_id in its address. If the login page is served by HTTPS, set account.scheme too.",
+	},
+	{
+		Name:        "ict-cas-wired",
+		Description: "Institute of Computing Technology, CAS, wired network",
+		Servers:     []string{"gw.ict.ac.cn"},
+		Notes: "Check that the login page is served by gw.ict.ac.cn, and set account.scheme and account.ac_id as in " +
+			"its address.",
+	},
+	{
+		Name:        "ict-cas-wireless",
+		Description: "Institute of Computing Technology, CAS, wireless network",
+		Servers:     []string{"gw.ict.ac.cn"},
+		Notes: "Check that the login page is served by gw.ict.ac.cn, and set account.scheme and account.ac_id as in " +
+			"its address.",
+	},
+}
+
+// Apply sets the settings known by the preset, which the config file may override.
+func (p Preset) Apply(settings *Settings) {
+	settings.Preset = p.Name
+	if len(p.Servers) > 0 {
+		settings.Account.AuthServer = p.Servers[0]
+	}
+	if p.Scheme != "" {
+		settings.Account.Scheme = p.Scheme
+	}
+	if p.AcID != "" {
+		settings.Account.AcID = p.AcID
+	}
+	if p.OnlineDetectionMethod != "" {
+		settings.Control.OnlineDetectionMethod = p.OnlineDetectionMethod
+	}
+}
+
+// Omit returns a copy of the settings without the ones equal to the preset, which are then left out of the config file.
+func (p Preset) Omit(settings *Settings) *Settings {
+	omitted := *settings
+	if len(p.Servers) > 0 && omitted.Account.AuthServer == p.Servers[0] {
+		omitted.Account.AuthServer = ""
+	}
+	if p.Scheme != "" && omitted.Account.Scheme == p.Scheme {
+		omitted.Account.Scheme = ""
+	}
+	if p.AcID != "" && omitted.Account.AcID == p.AcID {
+		omitted.Account.AcID = ""
+	}
+	if p.OnlineDetectionMethod != "" && omitted.Control.OnlineDetectionMethod == p.OnlineDetectionMethod {
+		omitted.Control.OnlineDetectionMethod = ""
+	}
+	return &omitted
+}
+
+// PresetDirs lists the directories of the user preset files, in the order of precedence.
+func PresetDirs() []string {
+	var dirs []string
+	if dir := os.Getenv(PRESET_DIR_ENV); dir != "" {
+		dirs = append(dirs, dir)
+	}
+	if dir, err := os.UserConfigDir(); err == nil {
+		dirs = append(dirs, filepath.Join(dir, "sdunetd", "presets"))
+	}
+	return append(dirs, "/etc/sdunetd/presets")
+}
+
+// LoadPresets returns the built-in presets and the ones in PresetDirs, sorted by name. A preset file holds one preset
+// in JSON, YAML or TOML, named after the file if the name is missing. User presets replace built-in ones of the same name.
+// A directory or a file that can't be read is skipped with a warning to Logger, so that it breaks no other preset.
+func LoadPresets() []Preset {
+	presets := make(map[string]Preset)
+	for _, preset := range builtinPresets {
+		presets[preset.Name] = preset
+	}
+
+	dirs := PresetDirs()
+	// the directories of lower precedence first, so that the higher ones replace them
+	for i := len(dirs) - 1; i >= 0; i-- {
+		files, err := ioutil.ReadDir(dirs[i])
+		if err != nil {
+			if !os.IsNotExist(err) {
+				Logger.Println(text("preset.skipped_dir", err))
+			}
+			continue
+		}
+		for _, file := range files {
+			if file.IsDir() || FormatFromExtension(file.Name()) == "" {
+				continue
+			}
+			preset, err := loadPresetFile(filepath.Join(dirs[i], file.Name()))
+			if err != nil {
+				Logger.Println(text("preset.skipped_file", err))
+				continue
+			}
+			presets[preset.Name] = preset
+		}
+	}
+
+	var list []Preset
+	for _, preset := range presets {
+		list = append(list, preset)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// FindPreset returns the preset of the name from LoadPresets.
+func FindPreset(name string) (Preset, error) {
+	for _, preset := range LoadPresets() {
+		if preset.Name == name {
+			return preset, nil
+		}
+	}
+	return Preset{}, errors.New(text("preset.unknown", name))
+}
+
+func loadPresetFile(path string) (Preset, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Preset{}, err
+	}
+	var preset Preset
+	err = unmarshalValue(FormatFromExtension(path), content, &preset)
+	if err != nil {
+		return Preset{}, errors.New(path + ": " + err.Error())
+	}
+	if preset.Name == "" {
+		preset.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	return preset, nil
+}
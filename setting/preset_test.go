@@ -0,0 +1,157 @@
+/*
+Copyright © 2018-2022 Sad Pencil
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the “Software”), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package setting
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// withPresetDir points PRESET_DIR_ENV to a new directory, and returns it with a function to undo it.
+func withPresetDir(t *testing.T) (string, func()) {
+	dir := tempDir(t)
+	old, ok := os.LookupEnv(PRESET_DIR_ENV)
+	_ = os.Setenv(PRESET_DIR_ENV, dir)
+	return dir, func() {
+		if ok {
+			_ = os.Setenv(PRESET_DIR_ENV, old)
+		} else {
+			_ = os.Unsetenv(PRESET_DIR_ENV)
+		}
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func TestSavedConfigFollowsPreset(t *testing.T) {
+	presetDir, undo := withPresetDir(t)
+	defer undo()
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	for _, ext := range []string{".json", ".yaml", ".toml"} {
+		preset := Preset{Name: "campus", Servers: []string{"10.0.0.1"}, Scheme: "https", AcID: "2"}
+		settings := NewSettings()
+		preset.Apply(settings)
+		settings.Account.Username = "user"
+		settings.Account.Password = "secret"
+		err := ioutil.WriteFile(filepath.Join(presetDir, "campus.yaml"), []byte("servers: [10.0.0.1]\nscheme: https\nac_id: \"2\"\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		configPath := filepath.Join(dir, "config"+ext)
+		err = SaveSettings(configPath, settings)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the preset changes after the config file is saved
+		err = ioutil.WriteFile(filepath.Join(presetDir, "campus.yaml"), []byte("servers: [10.0.0.9]\nscheme: https\nac_id: \"3\"\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := LoadSettings(configPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loaded.Account.AuthServer != "10.0.0.9" || loaded.Account.AcID != "3" || loaded.Account.Scheme != "https" {
+			t.Errorf("%s: the config file doesn't follow the preset: %+v", ext, loaded.Account)
+		}
+		if loaded.Account.Username != "user" || loaded.Account.Password != "secret" {
+			t.Errorf("%s: the account is lost: %+v", ext, loaded.Account)
+		}
+	}
+}
+
+func TestSavedConfigKeepsOverrides(t *testing.T) {
+	presetDir, undo := withPresetDir(t)
+	defer undo()
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	err := ioutil.WriteFile(filepath.Join(presetDir, "campus.yaml"), []byte("servers: [10.0.0.1, 10.0.0.2]\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings := NewSettings()
+	settings.Preset = "campus"
+	settings.Account.AuthServer = "10.0.0.2"
+	configPath := filepath.Join(dir, "config.json")
+	if err := SaveSettings(configPath, settings); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadSettings(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Account.AuthServer != "10.0.0.2" {
+		t.Errorf("the server that differs from the preset is lost: %s", loaded.Account.AuthServer)
+	}
+}
+
+func TestBrokenPresetFileIsSkipped(t *testing.T) {
+	presetDir, undo := withPresetDir(t)
+	defer undo()
+	oldLogger := Logger
+	Logger = log.New(ioutil.Discard, "", 0)
+	defer func() { Logger = oldLogger }()
+
+	err := ioutil.WriteFile(filepath.Join(presetDir, "broken.json"), []byte("{"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(presetDir, "campus.yaml"), []byte("servers: [10.0.0.1]\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FindPreset("campus"); err != nil {
+		t.Error(err)
+	}
+	if _, err := FindPreset("sdu-qingdao-wired"); err != nil {
+		t.Error(err)
+	}
+	if _, err := FindPreset("broken"); err == nil {
+		t.Error("the broken preset is found")
+	}
+
+	// a directory that can't be read
+	_ = os.Setenv(PRESET_DIR_ENV, filepath.Join(presetDir, "campus.yaml"))
+	if _, err := FindPreset("sdu-qingdao-wired"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBuiltinPresets(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, preset := range builtinPresets {
+		if seen[preset.Name] {
+			t.Errorf("%s: the name is duplicated", preset.Name)
+		}
+		seen[preset.Name] = true
+		if preset.Description == "" {
+			t.Errorf("%s: the description is empty", preset.Name)
+		}
+		// an unconfirmed value is left empty, and the notes tell what to check
+		if (len(preset.Servers) == 0 || preset.Scheme == "" || preset.AcID == "") && preset.Notes == "" {
+			t.Errorf("%s: a value is missing without notes", preset.Name)
+		}
+		for _, server := range preset.Servers {
+			if server == "" {
+				t.Errorf("%s: a server is empty", preset.Name)
+			}
+		}
+	}
+	for _, name := range []string{"sdu-qingdao-wired", "sdu-qingdao-wireless", "sdu-jinan-wireless", "ict-cas-wired", "ict-cas-wireless"} {
+		if !seen[name] {
+			t.Errorf("%s is not built in", name)
+		}
+	}
+}
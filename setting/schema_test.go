@@ -0,0 +1,117 @@
+/*
+Copyright © 2018-2022 Sad Pencil
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the “Software”), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package setting
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// The published schema is generated by "sdunetd config schema > config.schema.json".
+const publishedSchema = "../config.schema.json"
+
+func TestPublishedSchemaIsUpToDate(t *testing.T) {
+	published, err := ioutil.ReadFile(publishedSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	generated, err := MarshalSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bytes.ReplaceAll(published, []byte("\r\n"), []byte("\n")), generated) {
+		t.Errorf(`%s is out of date. Regenerate it with "sdunetd config schema > config.schema.json"`, publishedSchema)
+	}
+}
+
+func TestSchemaDescribesEverySetting(t *testing.T) {
+	paths := make(map[string]bool)
+	collectSchemaPaths(t, Schema(), "", paths)
+
+	for path := range paths {
+		if _, ok := schemaDescriptions[path]; !ok && !isMapValuePath(path) {
+			t.Errorf("the setting %q has no description in schemaDescriptions", path)
+		}
+	}
+	for _, annotations := range []map[string]bool{
+		keysOf(schemaDescriptions), keysOf(schemaEnums), keysOf(schemaMinimums), keysOf(schemaMaximums),
+	} {
+		for path := range annotations {
+			if !paths[path] {
+				t.Errorf("the schema annotates %q, which is not a setting", path)
+			}
+		}
+	}
+}
+
+func TestSchemaDefaultsMatchNewSettings(t *testing.T) {
+	fields := Fields(NewSettings())
+	properties := Schema()["properties"].(map[string]interface{})
+	for _, field := range fields {
+		schema := properties
+		var leaf map[string]interface{}
+		for _, name := range strings.Split(field.Path, ".") {
+			leaf = schema[name].(map[string]interface{})
+			if nested, ok := leaf["properties"].(map[string]interface{}); ok {
+				schema = nested
+			}
+		}
+		def, ok := leaf["default"]
+		if !ok {
+			continue
+		}
+		if def != field.value.Interface() {
+			t.Errorf("the default of %s is %v in the schema, but %v in NewSettings", field.Path, def, field.value.Interface())
+		}
+	}
+}
+
+func collectSchemaPaths(t *testing.T, schema map[string]interface{}, path string, paths map[string]bool) {
+	paths[path] = true
+	prefix := path
+	if prefix != "" {
+		prefix += "."
+	}
+	if properties, ok := schema["properties"].(map[string]interface{}); ok {
+		for name, child := range properties {
+			collectSchemaPaths(t, child.(map[string]interface{}), prefix+name, paths)
+		}
+	}
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		collectSchemaPaths(t, items, path+"[]", paths)
+	}
+	if values, ok := schema["additionalProperties"].(map[string]interface{}); ok {
+		collectSchemaPaths(t, values, path+"{}", paths)
+	}
+}
+
+// isMapValuePath tells whether the path is the value of a map, e.g. network.headers{}, which needs no description.
+func isMapValuePath(path string) bool {
+	return strings.HasSuffix(path, "{}")
+}
+
+func keysOf(m interface{}) map[string]bool {
+	keys := make(map[string]bool)
+	switch m := m.(type) {
+	case map[string]string:
+		for k := range m {
+			keys[k] = true
+		}
+	case map[string][]string:
+		for k := range m {
+			keys[k] = true
+		}
+	case map[string]int:
+		for k := range m {
+			keys[k] = true
+		}
+	}
+	return keys
+}
@@ -9,41 +9,98 @@ package setting
 
 import (
 	"encoding/json"
+	"github.com/SadPencil/sdunetd/utils"
 	"io/ioutil"
 )
 
 type Account struct {
-	Username   string `json:"username"`
-	Password   string `json:"password"`
-	AuthServer string `json:"server"`
-	Scheme     string `json:"scheme"`
+	Username string `json:"username" yaml:"username" toml:"username"`
+	Password string `json:"password" yaml:"password" toml:"password"`
+	// PasswordFile, PasswordCommand and PasswordCredential are the alternatives to the plaintext password. They are read
+	// at every login, so that the password can be rotated without restarting.
+	PasswordFile       string `json:"password_file" yaml:"password_file" toml:"password_file"`
+	PasswordCommand    string `json:"password_command" yaml:"password_command" toml:"password_command"`
+	PasswordCredential string `json:"password_credential" yaml:"password_credential" toml:"password_credential"`
+	// EncryptedPassword is decrypted with the key derived from KeyFile, or from the machine-id if KeyFile is empty.
+	EncryptedPassword string `json:"encrypted_password" yaml:"encrypted_password" toml:"encrypted_password"`
+	KeyFile           string `json:"key_file" yaml:"key_file" toml:"key_file"`
+	AuthServer        string `json:"server,omitempty" yaml:"server,omitempty" toml:"server,omitempty"`
+	Scheme            string `json:"scheme,omitempty" yaml:"scheme,omitempty" toml:"scheme,omitempty"`
+	// AcID is the ac_id parameter of the portal, which differs among the networks of some campuses.
+	AcID string `json:"ac_id,omitempty" yaml:"ac_id,omitempty" toml:"ac_id,omitempty"`
 }
 
 type Network struct {
-	Interface        string `json:"interface"`
-	StrictMode       bool   `json:"strict"`
-	Timeout          int32  `json:"timeout"`
-	MaxRetryCount    int32  `json:"max_retry_count"`
-	RetryIntervalSec int32  `json:"retry_interval_sec"`
+	Interface        string            `json:"interface" yaml:"interface" toml:"interface"`
+	StrictMode       bool              `json:"strict" yaml:"strict" toml:"strict"`
+	BindMode         string            `json:"bind_mode" yaml:"bind_mode" toml:"bind_mode"`
+	BindAddress      string            `json:"bind_address" yaml:"bind_address" toml:"bind_address"`
+	FwMark           uint32            `json:"fwmark" yaml:"fwmark" toml:"fwmark"`
+	TOS              int32             `json:"tos" yaml:"tos" toml:"tos"`
+	Netns            string            `json:"netns" yaml:"netns" toml:"netns"`
+	DNSServers       []string          `json:"dns_servers" yaml:"dns_servers" toml:"dns_servers"`
+	Hosts            map[string]string `json:"hosts" yaml:"hosts" toml:"hosts"`
+	Timeout          int32             `json:"timeout" yaml:"timeout" toml:"timeout"`
+	MaxRetryCount    int32             `json:"max_retry_count" yaml:"max_retry_count" toml:"max_retry_count"`
+	RetryIntervalSec int32             `json:"retry_interval_sec" yaml:"retry_interval_sec" toml:"retry_interval_sec"`
+	IPSource         string            `json:"ip_source" yaml:"ip_source" toml:"ip_source"`
+	IP               string            `json:"ip" yaml:"ip" toml:"ip"`
+	IPCommand        string            `json:"ip_command" yaml:"ip_command" toml:"ip_command"`
+	TLS              TLS               `json:"tls" yaml:"tls" toml:"tls"`
+	Proxy            string            `json:"proxy" yaml:"proxy" toml:"proxy"`
+	DetectionProxy   string            `json:"detection_proxy" yaml:"detection_proxy" toml:"detection_proxy"`
+	UserAgent        string            `json:"user_agent" yaml:"user_agent" toml:"user_agent"`
+	Headers          map[string]string `json:"headers" yaml:"headers" toml:"headers"`
+}
+
+type TLS struct {
+	CAFile             string   `json:"ca_file" yaml:"ca_file" toml:"ca_file"`
+	PinSHA256          []string `json:"pin_sha256" yaml:"pin_sha256" toml:"pin_sha256"`
+	ServerName         string   `json:"server_name" yaml:"server_name" toml:"server_name"`
+	MinVersion         string   `json:"min_version" yaml:"min_version" toml:"min_version"`
+	InsecureSkipVerify bool     `json:"insecure_skip_verify" yaml:"insecure_skip_verify" toml:"insecure_skip_verify"`
 }
 
 type Control struct {
-	MaxRetryCount         int32  `json:"max_retry_count"`
-	RetryIntervalSec      int32  `json:"retry_interval_sec"`
-	LoopIntervalSec       int32  `json:"loop_interval_sec"`
-	LogoutWhenExit        bool   `json:"logout_when_exit"`
-	OnlineDetectionMethod string `json:"online_detection_method"`
+	MaxRetryCount         int32  `json:"max_retry_count" yaml:"max_retry_count" toml:"max_retry_count"`
+	RetryIntervalSec      int32  `json:"retry_interval_sec" yaml:"retry_interval_sec" toml:"retry_interval_sec"`
+	LoopIntervalSec       int32  `json:"loop_interval_sec" yaml:"loop_interval_sec" toml:"loop_interval_sec"`
+	LogoutWhenExit        bool   `json:"logout_when_exit" yaml:"logout_when_exit" toml:"logout_when_exit"`
+	OnlineDetectionMethod string `json:"online_detection_method,omitempty" yaml:"online_detection_method,omitempty" toml:"online_detection_method,omitempty"`
+	StatusFile            string `json:"status_file" yaml:"status_file" toml:"status_file"`
+}
+
+// Device is a LAN device that is logged in on behalf of, e.g. a printer that can't run sdunetd.
+type Device struct {
+	Name     string `json:"name" yaml:"name" toml:"name"`
+	IP       string `json:"ip" yaml:"ip" toml:"ip"`
+	Username string `json:"username" yaml:"username" toml:"username"`
+	Password string `json:"password" yaml:"password" toml:"password"`
+	// The other sources of the password are the same as the ones of Account. No source means the password of the account.
+	PasswordFile       string `json:"password_file" yaml:"password_file" toml:"password_file"`
+	PasswordCommand    string `json:"password_command" yaml:"password_command" toml:"password_command"`
+	PasswordCredential string `json:"password_credential" yaml:"password_credential" toml:"password_credential"`
+	EncryptedPassword  string `json:"encrypted_password" yaml:"encrypted_password" toml:"encrypted_password"`
+	KeyFile            string `json:"key_file" yaml:"key_file" toml:"key_file"`
+	// ReloginIntervalSec applies when the portal can't tell the online state of the device.
+	ReloginIntervalSec int32 `json:"relogin_interval_sec" yaml:"relogin_interval_sec" toml:"relogin_interval_sec"`
 }
 
 type Settings struct {
-	Account Account `json:"account"`
-	Network Network `json:"network"`
-	Control Control `json:"control"`
+	// Version is the layout of the config file. Older layouts are migrated when loading.
+	Version int `json:"version" yaml:"version" toml:"version"`
+	// Preset names the preset whose settings are applied before the config file.
+	Preset  string   `json:"preset" yaml:"preset" toml:"preset"`
+	Account Account  `json:"account" yaml:"account" toml:"account"`
+	Network Network  `json:"network" yaml:"network" toml:"network"`
+	Control Control  `json:"control" yaml:"control" toml:"control"`
+	Devices []Device `json:"devices" yaml:"devices" toml:"devices"`
 }
 
 func NewSettings() *Settings {
 	return &Settings{
-		Account: Account{Scheme: DEFAULT_AUTH_SCHEME, AuthServer: DEFAULT_AUTH_SERVER},
+		Version: CONFIG_VERSION,
+		Account: Account{Scheme: DEFAULT_AUTH_SCHEME, AuthServer: DEFAULT_AUTH_SERVER, AcID: DEFAULT_AC_ID},
 		Control: Control{
 			LoopIntervalSec:       60,
 			RetryIntervalSec:      1,
@@ -54,26 +111,81 @@ func NewSettings() *Settings {
 		Network: Network{
 			Interface:        "",
 			StrictMode:       false,
+			BindMode:         BIND_MODE_DEVICE,
 			Timeout:          3,
 			MaxRetryCount:    3,
 			RetryIntervalSec: 1,
+			IPSource:         IP_SOURCE_PORTAL,
 		},
 	}
 }
 
-// LoadSettings -- Load settings from config file
+// LoadSettings -- Load settings from config file, in JSON, YAML or TOML
 func LoadSettings(configPath string) (settings *Settings, err error) {
+	settings, _, err = LoadAndMigrateSettings(configPath)
+	return settings, err
+}
+
+// LoadAndMigrateSettings loads the settings like LoadSettings, and also describes the migrations applied in memory if
+// the config file is in an older layout.
+func LoadAndMigrateSettings(configPath string) (settings *Settings, notes []string, err error) {
 	// LoadSettings from config file
 	file, err := ioutil.ReadFile(configPath)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	format := DetectFormat(configPath, file)
+
+	raw, err := unmarshalRaw(format, file)
+	if err != nil {
+		return nil, nil, err
+	}
+	notes, err = migrate(raw)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	settings = NewSettings()
-	err = json.Unmarshal(file, &settings)
+	if name, ok := raw["preset"].(string); ok && name != "" {
+		preset, err := FindPreset(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		preset.Apply(settings)
+	}
+	if len(notes) == 0 {
+		err = Unmarshal(format, file, settings)
+	} else {
+		// decode the migrated layout, which is plain maps and values, via JSON
+		var migrated []byte
+		migrated, err = json.Marshal(raw)
+		if err == nil {
+			err = json.Unmarshal(migrated, settings)
+		}
+	}
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return settings, nil
+	return settings, notes, nil
+}
+
+// SaveSettings writes the settings to the config file in the format of its extension, defaulting to JSON.
+// The file is replaced atomically and is readable by the owner only, since it may hold the password. The settings equal
+// to the ones of the preset are left out, so that the file keeps following the preset when it changes.
+func SaveSettings(configPath string, settings *Settings) error {
+	format := FormatFromExtension(configPath)
+	if format == "" {
+		format = FORMAT_JSON
+	}
+	if settings.Preset != "" {
+		if preset, err := FindPreset(settings.Preset); err == nil {
+			settings = preset.Omit(settings)
+		}
+	}
+	content, err := Marshal(format, settings)
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(configPath, content, 0600)
 }
@@ -0,0 +1,137 @@
+/*
+Copyright © 2018-2022 Sad Pencil
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the “Software”), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package setting
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// UnknownKey is a key of the config file that matches no setting, usually a typo.
+type UnknownKey struct {
+	Path string
+	// Suggestion is the closest known key at the same level, or empty if nothing is close.
+	Suggestion string
+}
+
+// UnknownKeys lists the keys of the config file that are ignored when loading it. A file of an older layout is
+// migrated first, so that the keys consumed by the migration are not reported.
+func UnknownKeys(format string, content []byte) ([]UnknownKey, error) {
+	raw, err := unmarshalRaw(format, content)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := migrate(raw); err != nil {
+		return nil, err
+	}
+
+	// the JSON and the TOML decoders fall back to a case-insensitive match of the keys, but the YAML one doesn't
+	foldCase := format != FORMAT_YAML
+	var unknownKeys []UnknownKey
+	walkUnknownKeys(reflect.TypeOf(Settings{}), raw, "", foldCase, &unknownKeys)
+	sort.Slice(unknownKeys, func(i, j int) bool { return unknownKeys[i].Path < unknownKeys[j].Path })
+	return unknownKeys, nil
+}
+
+func walkUnknownKeys(t reflect.Type, value interface{}, path string, foldCase bool, unknownKeys *[]UnknownKey) {
+	switch t.Kind() {
+	case reflect.Struct:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return
+		}
+		fields := make(map[string]reflect.Type)
+		var names []string
+		for i := 0; i < t.NumField(); i++ {
+			name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+			fields[name] = t.Field(i).Type
+			names = append(names, name)
+		}
+		prefix := path
+		if prefix != "" {
+			prefix += "."
+		}
+		for key, child := range object {
+			if path == "" && key == "$schema" {
+				continue
+			}
+			fieldType, ok := fields[key]
+			if !ok && foldCase {
+				for _, name := range names {
+					if strings.EqualFold(key, name) {
+						fieldType, ok = fields[name], true
+						break
+					}
+				}
+			}
+			if !ok {
+				*unknownKeys = append(*unknownKeys, UnknownKey{Path: prefix + key, Suggestion: closestKey(key, names)})
+				continue
+			}
+			walkUnknownKeys(fieldType, child, prefix+key, foldCase, unknownKeys)
+		}
+	case reflect.Slice:
+		array, ok := value.([]interface{})
+		if !ok {
+			return
+		}
+		for i, child := range array {
+			walkUnknownKeys(t.Elem(), child, fmt.Sprintf("%s[%d]", path, i), foldCase, unknownKeys)
+		}
+	}
+}
+
+// closestKey returns the candidate within an edit distance of 2, or empty if there is none.
+func closestKey(key string, candidates []string) string {
+	best := ""
+	bestDistance := 3
+	for _, candidate := range candidates {
+		distance := editDistance(strings.ToLower(key), candidate)
+		if distance < bestDistance {
+			best = candidate
+			bestDistance = distance
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance of the two strings.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
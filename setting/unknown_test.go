@@ -0,0 +1,98 @@
+/*
+Copyright © 2018-2022 Sad Pencil
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the “Software”), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package setting
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUnknownKeysOfAnOlderLayout(t *testing.T) {
+	content := []byte(`{
+  "account": {"username": "user", "password": "secret"},
+  "log": {"filename": "sdunetd.log"}
+}`)
+	if _, err := UnknownKeys(FORMAT_JSON, content); err == nil {
+		t.Error("a file of an older layout is checked as the current one")
+	}
+}
+
+func TestUnknownKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		content string
+		want    []UnknownKey
+	}{
+		{"known keys", FORMAT_JSON, `{"$schema": "./config.schema.json", "account": {"username": "user"}}`, nil},
+		{"typo with a suggestion", FORMAT_JSON, `{"acount": {}, "control": {"loop_intervl_sec": 60}}`,
+			[]UnknownKey{{"acount", "account"}, {"control.loop_intervl_sec", "loop_interval_sec"}}},
+		{"typo without a suggestion", FORMAT_JSON, `{"account": {"nickname": "user"}}`,
+			[]UnknownKey{{"account.nickname", ""}}},
+		{"nested in an array", FORMAT_JSON, `{"devices": [{"ip": "10.0.0.50"}, {"ipp": "10.0.0.51", "name": "board"}]}`,
+			[]UnknownKey{{"devices[1].ipp", "ip"}}},
+		{"a map of any keys", FORMAT_JSON, `{"network": {"hosts": {"portal.example": "10.0.0.1"}}}`, nil},
+		{"case-insensitive in JSON", FORMAT_JSON, `{"Account": {"UserName": "user"}}`, nil},
+		{"case-insensitive in TOML", FORMAT_TOML, "[Account]\nUserName = \"user\"\n", nil},
+		{"case-sensitive in YAML", FORMAT_YAML, "account:\n  Username: user\n",
+			[]UnknownKey{{"account.Username", "username"}}},
+	}
+	for _, test := range tests {
+		got, err := UnknownKeys(test.format, []byte(test.content))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestClosestKey(t *testing.T) {
+	candidates := []string{"username", "password", "password_file", "server"}
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"usrname", "username"},
+		{"USERNAME", "username"},
+		{"pasword", "password"},
+		{"password_fil", "password_file"},
+		{"servers", "server"},
+		{"nickname", ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := closestKey(test.key, candidates); got != test.want {
+			t.Errorf("closestKey(%q) = %q, want %q", test.key, got, test.want)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"", "abc", 3},
+		{"abc", "", 3},
+		{"abc", "abc", 0},
+		{"abc", "abd", 1},
+		{"abc", "ab", 1},
+		{"ab", "abc", 1},
+		{"kitten", "sitting", 3},
+		{"scheme", "shceme", 2},
+	}
+	for _, test := range tests {
+		if got := editDistance(test.a, test.b); got != test.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
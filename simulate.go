@@ -0,0 +1,142 @@
+/*
+Copyright © 2018-2022 Sad Pencil
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the “Software”), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"github.com/SadPencil/sdunetd/fakeportal"
+	"github.com/SadPencil/sdunetd/setting"
+	"log"
+	"os"
+	"reflect"
+	"time"
+)
+
+func simulate(args []string) error {
+	flags := flag.NewFlagSet("simulate", flag.ExitOnError)
+
+	var FlagConfigFile string
+	flags.StringVar(&FlagConfigFile, "c", "", "the path to the config.json file. The server, the scheme and the network settings except the timeout and the retries are overridden. Leave it blank to use the default settings.")
+
+	var FlagScenarioFile string
+	flags.StringVar(&FlagScenarioFile, "s", "", `the path to the scenario file. Each line is an event like "at 30s offline", "at 0s reject E2531" or "at 60s ip 10.0.0.5".`)
+
+	var FlagDuration time.Duration
+	flags.DurationVar(&FlagDuration, "d", 0, "stop the simulation after the duration, e.g. 2m. Zero means running until interrupted.")
+
+	var FlagInterval int
+	flags.IntVar(&FlagInterval, "i", 5, "the loop interval in seconds, overriding the config file.")
+
+	var FlagClientIP string
+	flags.StringVar(&FlagClientIP, "ip", "10.0.0.2", "the initial client IP address reported by the fake portal.")
+
+	var FlagVerbose bool
+	flags.BoolVar(&FlagVerbose, "v", false, "option: output verbose log")
+
+	_ = flags.Parse(args)
+
+	var events []fakeportal.Event
+	if FlagScenarioFile != "" {
+		f, err := os.Open(FlagScenarioFile)
+		if err != nil {
+			return err
+		}
+		events, err = fakeportal.ParseScenario(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	settings := setting.NewSettings()
+	if FlagConfigFile != "" {
+		var err error
+		settings, err = setting.LoadSettings(FlagConfigFile)
+		if err != nil {
+			return err
+		}
+	}
+	if settings.Account.Username == "" {
+		settings.Account.Username = "simulator"
+	}
+	if len(passwordSources(settings.Account)) == 0 {
+		settings.Account.Password = "simulator"
+	}
+	if settings.Control.OnlineDetectionMethod != setting.ONLINE_DETECTION_METHOD_AUTH {
+		logger.Println(msg("simulate.detection_method", setting.ONLINE_DETECTION_METHOD_AUTH))
+		settings.Control.OnlineDetectionMethod = setting.ONLINE_DETECTION_METHOD_AUTH
+	}
+	settings.Control.LoopIntervalSec = int32(FlagInterval)
+	// the fake portal is reached on the loopback interface directly, and knows the client IP address it reports only,
+	// so the binding, the resolver, the proxies, the TLS options and the IP source of the config file don't apply
+	defaults := setting.NewSettings().Network
+	defaults.Timeout = settings.Network.Timeout
+	defaults.MaxRetryCount = settings.Network.MaxRetryCount
+	defaults.RetryIntervalSec = settings.Network.RetryIntervalSec
+	defaults.UserAgent = settings.Network.UserAgent
+	defaults.Headers = settings.Network.Headers
+	if !reflect.DeepEqual(settings.Network, defaults) {
+		logger.Println(msg("simulate.network_reset"))
+	}
+	settings.Network = defaults
+	problems := validateSettings(FlagConfigFile, settings)
+	for _, p := range problems {
+		logger.Println(p)
+	}
+	if hasErrors(problems) {
+		return errors.New(msg("validate.invalid"))
+	}
+
+	if FlagVerbose {
+		verboseLogger = logger
+	}
+
+	portal := fakeportal.NewPortal(FlagClientIP)
+	portal.Logger = log.New(logger.Writer(), "[portal] ", logger.Flags())
+	addr, err := portal.Start()
+	if err != nil {
+		return err
+	}
+	defer portal.Close()
+
+	settings.Account.Scheme = "http"
+	settings.Account.AuthServer = addr
+
+	version()
+	logger.Println("The fake portal is listening at", addr)
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+	if FlagDuration > 0 {
+		ctx, cancelFunc = context.WithTimeout(ctx, FlagDuration)
+		defer cancelFunc()
+	}
+	onExit(func() {
+		logger.Println("Exiting...")
+		cancelFunc()
+	})
+
+	d, err := newDaemon(settings)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		_ = fakeportal.RunScenario(ctx, portal, events)
+	}()
+
+	d.run(ctx)
+
+	if settings.Control.LogoutWhenExit {
+		_ = d.logout(context.Background())
+	}
+	logger.Println("Simulation finished. Online:", portal.Online())
+	return nil
+}
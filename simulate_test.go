@@ -0,0 +1,47 @@
+/*
+Copyright © 2018-2022 Sad Pencil
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the “Software”), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSimulateIgnoresTheNetworkSettings(t *testing.T) {
+	var output bytes.Buffer
+	oldLogger := logger
+	logger = log.New(&output, "", 0)
+	defer func() { logger = oldLogger }()
+	dir, err := ioutil.TempDir("", "sdunetd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a proxy that refuses connections, and a client IP address unknown to the fake portal
+	configFile := filepath.Join(dir, "config.json")
+	err = ioutil.WriteFile(configFile, []byte(`{
+  "account": {"username": "201700000000", "password": "secret"},
+  "network": {"proxy": "http://127.0.0.1:9", "ip_source": "fixed", "ip": "10.9.9.9", "dns_servers": ["192.0.2.1"]}
+}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = simulate([]string{"-c", configFile, "-d", "1500ms", "-i", "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output.String(), "Simulation finished. Online: true") {
+		t.Errorf("the simulation doesn't log in:\n%s", output.String())
+	}
+}
@@ -0,0 +1,82 @@
+/*
+Copyright © 2018-2022 Sad Pencil
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the “Software”), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"github.com/SadPencil/sdunetd/utils"
+	"time"
+)
+
+// status is the content of control.status_file, for other programs like a web page of the router to show.
+type status struct {
+	Updated time.Time      `json:"updated"`
+	Account accountStatus  `json:"account"`
+	Devices []deviceStatus `json:"devices"`
+}
+
+type accountStatus struct {
+	Username  string    `json:"username"`
+	IP        string    `json:"ip"`
+	Online    bool      `json:"online"`
+	LastCheck time.Time `json:"last_check"`
+	LastError string    `json:"last_error"`
+}
+
+type deviceStatus struct {
+	Name     string `json:"name"`
+	IP       string `json:"ip"`
+	Username string `json:"username"`
+	Online   bool   `json:"online"`
+	// Unknown means the portal can't tell the online state of the device, so Online is the result of the last login.
+	Unknown   bool      `json:"unknown"`
+	LastCheck time.Time `json:"last_check"`
+	LastError string    `json:"last_error"`
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func (d *daemon) status() status {
+	s := status{
+		Updated: time.Now(),
+		Account: accountStatus{
+			Username:  d.settings.Account.Username,
+			IP:        d.clientIP,
+			Online:    d.online,
+			LastCheck: d.lastCheck,
+			LastError: errorString(d.lastError),
+		},
+		Devices: []deviceStatus{},
+	}
+	for _, dev := range d.devices {
+		s.Devices = append(s.Devices, deviceStatus{
+			Name:      dev.Name,
+			IP:        dev.IP,
+			Username:  dev.Username,
+			Online:    dev.Online,
+			Unknown:   dev.Unknown,
+			LastCheck: dev.LastCheck,
+			LastError: errorString(dev.LastError),
+		})
+	}
+	return s
+}
+
+// writeStatus replaces the status file atomically, so that a reader never sees a partial one.
+func (d *daemon) writeStatus(path string) error {
+	content, err := json.MarshalIndent(d.status(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(path, append(content, '\n'), 0644)
+}
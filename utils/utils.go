@@ -8,9 +8,15 @@ THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR I
 package utils
 
 import (
+	"context"
 	"errors"
+	"io/ioutil"
 	"net"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
 )
 
 // PathExists returns whether the given file or directory exists
@@ -73,3 +79,66 @@ func GetIPv4FromInterface(networkInterface string) (string, error) {
 	}
 	return "", errors.New("can't get a vaild address from " + networkInterface)
 }
+
+//GetOutputOfCommand runs the shell command and returns its standard output
+func GetOutputOfCommand(ctx context.Context, command string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return string(output), nil
+}
+
+//GetIPFromCommand runs the shell command and parses its output as an IP address
+func GetIPFromCommand(ctx context.Context, command string) (string, error) {
+	output, err := GetOutputOfCommand(ctx, command)
+	if err != nil {
+		return "", err
+	}
+
+	ip := net.ParseIP(strings.TrimSpace(output))
+	if ip == nil {
+		return "", errors.New("can't get a vaild address from the output of " + command)
+	}
+	return ip.String(), nil
+}
+
+// WriteFileAtomic writes to a temporary file in the same directory and renames it over the target, so that a crash
+// never leaves a truncated file behind.
+func WriteFileAtomic(path string, content []byte, perm os.FileMode) (err error) {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}
+	}()
+
+	err = f.Chmod(perm)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(content)
+	if err != nil {
+		return err
+	}
+	err = f.Sync()
+	if err != nil {
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,263 @@
+/*
+Copyright © 2018-2022 Sad Pencil
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the “Software”), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package main
+
+import (
+	"fmt"
+	"github.com/SadPencil/sdunetd/sdunet"
+	"github.com/SadPencil/sdunetd/setting"
+	"github.com/SadPencil/sdunetd/utils"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// problem is a finding of validateSettings, located by the path of the setting, e.g. control.loop_interval_sec.
+type problem struct {
+	Path       string
+	Message    string
+	Suggestion string
+	Warning    bool
+}
+
+func (p problem) String() string {
+	level := msg("validate.error")
+	if p.Warning {
+		level = msg("validate.warning")
+	}
+	s := level + ": " + p.Path + ": " + p.Message
+	if p.Suggestion != "" {
+		s += "\n    " + msg("validate.suggestion") + ": " + p.Suggestion
+	}
+	return s
+}
+
+type validator struct {
+	problems []problem
+}
+
+func (v *validator) error(path string, suggestion string, message string) {
+	v.problems = append(v.problems, problem{Path: path, Message: message, Suggestion: suggestion})
+}
+
+func (v *validator) warn(path string, suggestion string, message string) {
+	v.problems = append(v.problems, problem{Path: path, Message: message, Suggestion: suggestion, Warning: true})
+}
+
+// check runs one of the check functions, which also normalize the settings.
+func (v *validator) check(path string, suggestion string, check func(*setting.Settings) error, settings *setting.Settings) {
+	if err := check(settings); err != nil {
+		v.error(path, suggestion, err.Error())
+	}
+}
+
+func hasErrors(problems []problem) bool {
+	for _, p := range problems {
+		if !p.Warning {
+			return true
+		}
+	}
+	return false
+}
+
+// validateSettings finds all the problems of the settings at once, and normalizes the settings like the check functions.
+// If configFile is not empty, its keys are checked for typos.
+func validateSettings(configFile string, settings *setting.Settings) []problem {
+	v := &validator{}
+
+	if configFile != "" {
+		content, err := ioutil.ReadFile(configFile)
+		if err != nil {
+			v.error("", "", err.Error())
+		} else {
+			unknownKeys, err := setting.UnknownKeys(setting.DetectFormat(configFile, content), content)
+			if err != nil {
+				v.error("", "", err.Error())
+			}
+			for _, key := range unknownKeys {
+				suggestion := msg("validate.remove")
+				if key.Suggestion != "" {
+					suggestion = msg("validate.did_you_mean", key.Suggestion)
+				}
+				v.warn(key.Path, suggestion, msg("validate.unknown_key"))
+			}
+		}
+	}
+
+	// account
+	v.check("account.username", "", checkUsername, settings)
+	v.check("account.password", msg("validate.password_sources"), checkPassword, settings)
+	v.check("account.server", msg("validate.server", setting.DEFAULT_AUTH_SERVER), checkAuthServer, settings)
+	v.check("account.scheme", msg("validate.scheme"), checkScheme, settings)
+	validatePasswordSource(v, "account", settings.Account)
+	settings.Account.AcID = strings.TrimSpace(settings.Account.AcID)
+	if settings.Account.AcID == "" {
+		v.error("account.ac_id", msg("validate.default", setting.DEFAULT_AC_ID), msg("validate.ac_id_empty"))
+	}
+
+	if settings.Preset != "" {
+		// a preset of a network whose server is not confirmed leaves the default server, which is of another network
+		preset, err := setting.FindPreset(settings.Preset)
+		if err == nil && len(preset.Servers) == 0 && settings.Account.AuthServer == setting.DEFAULT_AUTH_SERVER {
+			v.warn("account.server", preset.Notes, msg("validate.preset_server", preset.Name))
+		}
+	}
+
+	// network
+	v.check("network.ip_source", "", checkIPSource, settings)
+	v.check("network.bind_mode", msg("validate.bind_mode"), checkBindMode, settings)
+	v.check("network.tls", "", checkTLS, settings)
+	validateNetwork(v, &settings.Network)
+
+	// control
+	v.check("control.loop_interval_sec", msg("validate.default", 60), checkInterval, settings)
+	validateControl(v, &settings.Control)
+
+	v.check("devices", "", checkDevices, settings)
+	for i, device := range settings.Devices {
+		validatePasswordSource(v, fmt.Sprintf("devices[%d]", i), deviceAccount(device))
+	}
+
+	// the client validates the rest, e.g. the combination of the options
+	if !hasErrors(v.problems) {
+		if _, err := newManager(settings); err != nil {
+			v.error("network", "", err.Error())
+		} else if _, err := newManager(settings, sdunet.WithProxy(detectionProxy(settings.Network))); err != nil {
+			v.error("network.detection_proxy", "", err.Error())
+		}
+	}
+	return v.problems
+}
+
+// validatePasswordSource checks that the password source of the account, or of the device at the path, is usable.
+func validatePasswordSource(v *validator, path string, account setting.Account) {
+	switch {
+	case account.PasswordFile != "":
+		if exist, _ := utils.PathExists(account.PasswordFile); !exist {
+			v.error(path+".password_file", "", msg("validate.file_missing", account.PasswordFile))
+		}
+	case account.PasswordCredential != "":
+		if os.Getenv("CREDENTIALS_DIRECTORY") == "" {
+			v.warn(path+".password_credential", msg("validate.credential_unit", account.PasswordCredential),
+				msg("validate.credential_no_directory"))
+		}
+	case account.EncryptedPassword != "":
+		key, err := setting.LoadKey(account.KeyFile)
+		if err != nil {
+			v.error(path+".key_file", "", err.Error())
+		} else if _, err := setting.DecryptPassword(key, account.EncryptedPassword); err != nil {
+			v.error(path+".encrypted_password", msg("validate.reencrypt"), err.Error())
+		}
+	}
+}
+
+func validateNetwork(v *validator, network *setting.Network) {
+	network.Interface = strings.TrimSpace(network.Interface)
+	if network.Interface != "" {
+		if _, err := net.InterfaceByName(network.Interface); err != nil {
+			names := ""
+			if interfaces, err := net.Interfaces(); err == nil {
+				for _, iface := range interfaces {
+					names += " " + iface.Name
+				}
+			}
+			v.warn("network.interface", msg("validate.interfaces", names), msg("validate.interface_missing", network.Interface))
+		}
+	}
+	if network.StrictMode && network.Interface == "" {
+		if network.BindMode != setting.BIND_MODE_ADDRESS {
+			v.error("network.interface", msg("validate.strict_interface_suggestion"), msg("validate.strict_interface"))
+		} else if network.BindAddress == "" {
+			v.error("network.bind_address", msg("validate.strict_address_suggestion"), msg("validate.strict_address"))
+		}
+	}
+	if runtime.GOOS != "linux" {
+		if network.StrictMode && network.BindMode == setting.BIND_MODE_DEVICE {
+			v.error("network.bind_mode", msg("validate.use_address"), msg("validate.linux_bind_device"))
+		}
+		if network.FwMark != 0 {
+			v.error("network.fwmark", msg("validate.remove"), msg("validate.linux_fwmark"))
+		}
+		if network.TOS != 0 {
+			v.error("network.tos", msg("validate.remove"), msg("validate.linux_tos"))
+		}
+		if network.Netns != "" {
+			v.error("network.netns", msg("validate.remove"), msg("validate.linux_netns"))
+		}
+	}
+
+	if network.Timeout < 0 {
+		v.error("network.timeout", msg("validate.default", 3), msg("validate.timeout_negative"))
+	} else if network.Timeout == 0 {
+		v.warn("network.timeout", msg("validate.default", 3), msg("validate.timeout_zero"))
+	}
+	if network.MaxRetryCount < 0 {
+		v.error("network.max_retry_count", msg("validate.default", 3), msg("validate.retry_count_negative"))
+	}
+	if network.RetryIntervalSec < 0 {
+		v.error("network.retry_interval_sec", msg("validate.default", 1), msg("validate.retry_interval_negative"))
+	}
+
+	for i, server := range network.DNSServers {
+		host := server
+		if h, _, err := net.SplitHostPort(server); err == nil {
+			host = h
+		}
+		if net.ParseIP(strings.Trim(host, "[]")) == nil {
+			v.error(fmt.Sprintf("network.dns_servers[%d]", i), msg("validate.dns_server_suggestion"), msg("validate.dns_server", server))
+		}
+	}
+	for host, ip := range network.Hosts {
+		if net.ParseIP(ip) == nil {
+			v.error("network.hosts."+host, "", msg("validate.hosts_ip", ip))
+		}
+	}
+	validateProxy(v, "network.proxy", network.Proxy)
+	validateProxy(v, "network.detection_proxy", network.DetectionProxy)
+}
+
+func validateProxy(v *validator, path string, proxy string) {
+	if proxy == "" {
+		return
+	}
+	suggestion := msg("validate.proxy_suggestion")
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		v.error(path, suggestion, err.Error())
+		return
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		v.error(path, suggestion, msg("validate.proxy_scheme"))
+		return
+	}
+	if proxyURL.Host == "" {
+		v.error(path, suggestion, msg("validate.proxy_host"))
+	}
+}
+
+func validateControl(v *validator, control *setting.Control) {
+	control.OnlineDetectionMethod = strings.ToLower(strings.TrimSpace(control.OnlineDetectionMethod))
+	switch control.OnlineDetectionMethod {
+	case setting.ONLINE_DETECTION_METHOD_AUTH, setting.ONLINE_DETECTION_METHOD_MS:
+	case "":
+		control.OnlineDetectionMethod = setting.ONLINE_DETECTION_METHOD_AUTH
+	default:
+		v.error("control.online_detection_method", msg("validate.detection_method_suggestion"), msg("validate.detection_method", control.OnlineDetectionMethod))
+	}
+	if control.MaxRetryCount < 0 {
+		v.error("control.max_retry_count", msg("validate.default", 3), msg("validate.retry_count_negative"))
+	}
+	if control.RetryIntervalSec < 0 {
+		v.error("control.retry_interval_sec", msg("validate.default", 1), msg("validate.retry_interval_negative"))
+	}
+}
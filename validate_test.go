@@ -0,0 +1,169 @@
+/*
+Copyright © 2018-2022 Sad Pencil
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the “Software”), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package main
+
+import (
+	"github.com/SadPencil/sdunetd/setting"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// problemSummary is a problem without the messages, which depend on the language.
+type problemSummary struct {
+	Path    string
+	Warning bool
+}
+
+func summarize(problems []problem) []problemSummary {
+	var summaries []problemSummary
+	for _, p := range problems {
+		summaries = append(summaries, problemSummary{p.Path, p.Warning})
+	}
+	return summaries
+}
+
+func TestValidateSettings(t *testing.T) {
+	strictWant := []problemSummary{{"network.interface", false}}
+	if runtime.GOOS != "linux" {
+		strictWant = append(strictWant, problemSummary{"network.bind_mode", false})
+	}
+	tests := []struct {
+		name   string
+		modify func(*setting.Settings)
+		want   []problemSummary
+	}{
+		{"valid", func(s *setting.Settings) {}, nil},
+		{"negative timeout", func(s *setting.Settings) { s.Network.Timeout = -1 }, []problemSummary{{"network.timeout", false}}},
+		{"zero timeout", func(s *setting.Settings) { s.Network.Timeout = 0 }, []problemSummary{{"network.timeout", true}}},
+		{"negative retries", func(s *setting.Settings) { s.Network.MaxRetryCount = -1 }, []problemSummary{{"network.max_retry_count", false}}},
+		{"zero interval", func(s *setting.Settings) { s.Control.LoopIntervalSec = 0 }, []problemSummary{{"control.loop_interval_sec", false}}},
+		{"unknown detection method", func(s *setting.Settings) { s.Control.OnlineDetectionMethod = "ping" },
+			[]problemSummary{{"control.online_detection_method", false}}},
+		{"detection method in upper case", func(s *setting.Settings) { s.Control.OnlineDetectionMethod = " MS " }, nil},
+		{"strict mode without an interface", func(s *setting.Settings) { s.Network.StrictMode = true }, strictWant},
+		{"strict mode binding no address", func(s *setting.Settings) {
+			s.Network.StrictMode = true
+			s.Network.BindMode = setting.BIND_MODE_ADDRESS
+		}, []problemSummary{{"network.bind_address", false}}},
+		{"empty ac_id", func(s *setting.Settings) { s.Account.AcID = " " }, []problemSummary{{"account.ac_id", false}}},
+		{"two password sources", func(s *setting.Settings) { s.Account.PasswordCommand = "pass show campus" },
+			[]problemSummary{{"account.password", false}}},
+		{"ip_source interface without an interface", func(s *setting.Settings) { s.Network.IPSource = "interface" },
+			[]problemSummary{{"network.ip_source", false}}},
+		{"ip_source fixed without an address", func(s *setting.Settings) { s.Network.IPSource = "fixed" },
+			[]problemSummary{{"network.ip_source", false}}},
+		{"ip_source command without a command", func(s *setting.Settings) { s.Network.IPSource = " Command " },
+			[]problemSummary{{"network.ip_source", false}}},
+		{"unknown ip_source", func(s *setting.Settings) { s.Network.IPSource = "dhcp" }, []problemSummary{{"network.ip_source", false}}},
+		{"two password sources of a device", func(s *setting.Settings) {
+			s.Devices = []setting.Device{{IP: "10.0.0.50", Password: "secret", PasswordCommand: "pass show printer"}}
+		}, []problemSummary{{"devices", false}}},
+		{"missing password file of a device", func(s *setting.Settings) {
+			s.Devices = []setting.Device{{IP: "10.0.0.50", PasswordFile: "/nonexistent/password"}}
+		}, []problemSummary{{"devices[0].password_file", false}}},
+		{"proxy of an unknown scheme", func(s *setting.Settings) { s.Network.Proxy = "ftp://10.0.0.1" },
+			[]problemSummary{{"network.proxy", false}}},
+		{"invalid DNS server", func(s *setting.Settings) { s.Network.DNSServers = []string{"1.1.1.1", "dns.google"} },
+			[]problemSummary{{"network.dns_servers[1]", false}}},
+		{"invalid device", func(s *setting.Settings) { s.Devices = []setting.Device{{IP: "10.0.0.256"}} },
+			[]problemSummary{{"devices", false}}},
+		{"several problems at once", func(s *setting.Settings) {
+			s.Account.Username = ""
+			s.Network.Timeout = -1
+			s.Control.OnlineDetectionMethod = "ping"
+		}, []problemSummary{{"account.username", false}, {"network.timeout", false}, {"control.online_detection_method", false}}},
+	}
+	for _, test := range tests {
+		settings := setting.NewSettings()
+		settings.Account.Username = "201700000000"
+		settings.Account.Password = "secret"
+		test.modify(settings)
+		if got := summarize(validateSettings("", settings)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestValidateNormalizesSettings(t *testing.T) {
+	settings := setting.NewSettings()
+	settings.Account.Username = " 201700000000 "
+	settings.Account.Password = "secret"
+	settings.Account.Scheme = "HTTPS"
+	settings.Control.OnlineDetectionMethod = " MS "
+	if problems := validateSettings("", settings); len(problems) != 0 {
+		t.Fatal(problems)
+	}
+	if settings.Account.Username != "201700000000" || settings.Account.Scheme != "https" ||
+		settings.Control.OnlineDetectionMethod != setting.ONLINE_DETECTION_METHOD_MS {
+		t.Errorf("the settings are not normalized: %+v", settings)
+	}
+}
+
+func TestValidateReportsUnknownKeys(t *testing.T) {
+	defer func(saved string) { language = saved }(language)
+	language = LANG_EN
+
+	dir, err := ioutil.TempDir("", "sdunetd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	configFile := filepath.Join(dir, "config.json")
+	err = ioutil.WriteFile(configFile, []byte(`{
+  "account": {"Username": "201700000000", "pasword": "secret"},
+  "devices": [{"ip": "10.0.0.50", "relogin_interval": 3600}]
+}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings, err := setting.LoadSettings(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings.Account.Password = "secret"
+
+	problems := validateSettings(configFile, settings)
+	want := []problem{
+		{Path: "account.pasword", Message: msg("validate.unknown_key"), Suggestion: msg("validate.did_you_mean", "password"), Warning: true},
+		{Path: "devices[0].relogin_interval", Message: msg("validate.unknown_key"), Suggestion: msg("validate.remove"), Warning: true},
+	}
+	if !reflect.DeepEqual(problems, want) {
+		t.Errorf("got %v, want %v", problems, want)
+	}
+}
+
+func TestValidateWarnsAboutAPresetWithoutServer(t *testing.T) {
+	for _, name := range []string{"sdu-jinan-wireless", "sdu-qingdao-wireless"} {
+		preset, err := setting.FindPreset(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		settings := setting.NewSettings()
+		settings.Account.Username = "201700000000"
+		settings.Account.Password = "secret"
+		preset.Apply(settings)
+
+		var want []problemSummary
+		if len(preset.Servers) == 0 {
+			want = []problemSummary{{"account.server", true}}
+		}
+		if got := summarize(validateSettings("", settings)); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", name, got, want)
+		}
+
+		// the server given by the config file is trusted
+		settings.Account.AuthServer = "10.0.0.1"
+		if got := summarize(validateSettings("", settings)); got != nil {
+			t.Errorf("%s with a server: got %v", name, got)
+		}
+	}
+}